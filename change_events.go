@@ -0,0 +1,51 @@
+package pggen
+
+import (
+	"context"
+)
+
+// file: change_events.go
+// This file defines the change events that generated code reports when it
+// modifies a table.
+
+// ChangeOp is the kind of modification described by a ChangeEvent
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+	ChangeUpsert ChangeOp = "upsert"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// ChangeEvent describes a modification that generated code made to a table.
+type ChangeEvent struct {
+	// The name of the table that was modified, without a schema
+	Table string
+	// The kind of modification that was made
+	Op ChangeOp
+	// The primary keys of the modified records, as a slice of the primary key
+	// type of the table (e.g. a []int64).
+	IDs interface{}
+}
+
+// ChangeListener is a routine which gets told about the changes made by generated code
+type ChangeListener func(event ChangeEvent)
+
+type changeListenerKey struct{}
+
+// WithChangeListener returns a context which causes the generated insert, update, upsert,
+// delete and restore methods to report the changes that they make to the given listener.
+// Changes made within a transaction are only reported once the transaction commits, and
+// are never reported if it rolls back. Changes made outside of a transaction are reported
+// as soon as they are made.
+func WithChangeListener(ctx context.Context, listener ChangeListener) context.Context {
+	return context.WithValue(ctx, changeListenerKey{}, listener)
+}
+
+// ChangeListenerFromContext returns the listener attached to the given context by
+// WithChangeListener, or nil if there is no listener.
+func ChangeListenerFromContext(ctx context.Context) ChangeListener {
+	listener, _ := ctx.Value(changeListenerKey{}).(ChangeListener)
+	return listener
+}
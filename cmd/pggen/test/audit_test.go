@@ -0,0 +1,139 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/opendoor/pggen"
+	"github.com/opendoor/pggen/cmd/pggen/test/models"
+	"github.com/opendoor/pggen/middleware"
+)
+
+func TestAuditHistory(t *testing.T) {
+	aliceCtx := middleware.WithActor(ctx, "alice")
+
+	id, err := pgClient.InsertAuditedEntity(aliceCtx, &models.AuditedEntity{Value: "first"})
+	chkErr(t, err)
+	_, err = pgClient.UpdateAuditedEntity(
+		ctx, &models.AuditedEntity{Id: id, Value: "second"}, models.AuditedEntityAllFields)
+	chkErr(t, err)
+	err = pgClient.WithTx(middleware.WithActor(ctx, "bob"), nil, func(tx *models.TxPGClient) error {
+		return tx.DeleteAuditedEntity(middleware.WithActor(ctx, "bob"), id)
+	})
+	chkErr(t, err)
+	chkErr(t, pgClient.RestoreAuditedEntity(aliceCtx, id))
+	chkErr(t, pgClient.DeleteAuditedEntity(ctx, id, pggen.DeleteDoHardDelete))
+
+	history, err := pgClient.HistoryAuditedEntity(ctx, id)
+	chkErr(t, err)
+	if len(history) != 5 {
+		t.Fatalf("expected 5 versions, got %d", len(history))
+	}
+
+	actorOf := func(v models.AuditedEntityVersion) string {
+		if v.Actor == nil {
+			return ""
+		}
+		return *v.Actor
+	}
+	expected := []struct {
+		op        pggen.ChangeOp
+		actor     string
+		hasBefore bool
+		hasAfter  bool
+	}{
+		{pggen.ChangeInsert, "alice", false, true},
+		{pggen.ChangeUpdate, "", true, true},
+		{pggen.ChangeUpdate, "bob", true, true}, // a soft delete
+		{pggen.ChangeUpdate, "alice", true, true},
+		{pggen.ChangeDelete, "", true, false},
+	}
+	for i, exp := range expected {
+		v := history[i]
+		if v.Op != exp.op || actorOf(v) != exp.actor ||
+			(v.Before != nil) != exp.hasBefore || (v.After != nil) != exp.hasAfter {
+			t.Fatalf("version %d: unexpected version: %+v", i, v)
+		}
+		if v.ChangedAt.IsZero() {
+			t.Fatalf("version %d: missing change time", i)
+		}
+	}
+
+	if history[0].After.Value != "first" || history[1].Before.Value != "first" ||
+		history[1].After.Value != "second" {
+		t.Fatalf("unexpected records in the history: %+v %+v", history[0], history[1])
+	}
+	if history[2].Before.DeletedAt != nil || history[2].After.DeletedAt == nil {
+		t.Fatalf("expected the third version to be a soft delete: %+v", history[2])
+	}
+	if history[4].Before.Id != id {
+		t.Fatalf("expected the deleted record, got: %+v", history[4].Before)
+	}
+}
+
+func TestAuditHistoryPredatingNotNullColumn(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	// record some history before the NOT NULL 'value' column exists, so that
+	// the snapshots are missing it
+	_, err = txClient.Handle().ExecContext(ctx, `ALTER TABLE audited_entities DROP COLUMN value`)
+	chkErr(t, err)
+	var id int64
+	err = txClient.Handle().QueryRowContext(
+		ctx, `INSERT INTO audited_entities DEFAULT VALUES RETURNING id`).Scan(&id)
+	chkErr(t, err)
+	_, err = txClient.Handle().ExecContext(
+		ctx, `ALTER TABLE audited_entities ADD COLUMN value text NOT NULL DEFAULT 'added'`)
+	chkErr(t, err)
+	_, err = txClient.UpdateAuditedEntity(
+		ctx, &models.AuditedEntity{Id: id, Value: "updated"}, models.AuditedEntityAllFields)
+	chkErr(t, err)
+
+	history, err := txClient.HistoryAuditedEntity(ctx, id)
+	chkErr(t, err)
+	if len(history) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(history))
+	}
+	if history[0].After.Id != id || history[0].After.Value != "" {
+		t.Fatalf("expected the value to be missing from the insert: %+v", history[0].After)
+	}
+	if history[1].Before.Value != "added" || history[1].After.Value != "updated" {
+		t.Fatalf("unexpected update: %+v -> %+v", history[1].Before, history[1].After)
+	}
+}
+
+func TestAuditActorInTx(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	id, err := txClient.InsertAuditedEntity(middleware.WithActor(ctx, "carol"), &models.AuditedEntity{Value: "a"})
+	chkErr(t, err)
+	// an actor recorded earlier in the transaction should not leak into later writes
+	_, err = txClient.UpdateAuditedEntity(
+		ctx, &models.AuditedEntity{Id: id, Value: "b"}, models.AuditedEntityAllFields)
+	chkErr(t, err)
+
+	history, err := txClient.HistoryAuditedEntity(ctx, id)
+	chkErr(t, err)
+	if len(history) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(history))
+	}
+	if history[0].Actor == nil || *history[0].Actor != "carol" {
+		t.Fatalf("expected carol to have made the insert, got: %v", history[0].Actor)
+	}
+	if history[1].Actor != nil {
+		t.Fatalf("expected no actor for the update, got: %s", *history[1].Actor)
+	}
+
+	none, err := txClient.HistoryAuditedEntity(ctx, id+1000000)
+	chkErr(t, err)
+	if len(none) != 0 {
+		t.Fatalf("expected no history, got: %v", none)
+	}
+}
@@ -353,6 +353,17 @@ CREATE TABLE deletable_leafs (
         REFERENCES soft_deletables(id) ON DELETE RESTRICT ON UPDATE CASCADE,
     deleted_at timestamp
 );
+-- a table without a deleted_at field whose children can be soft deleted
+CREATE TABLE hard_deletables (
+    id SERIAL PRIMARY KEY,
+    value text NOT NULL
+);
+CREATE TABLE soft_deletable_leafs (
+    id SERIAL PRIMARY KEY,
+    value text NOT NULL,
+    hard_deletable_id integer NOT NULL REFERENCES hard_deletables(id),
+    deleted_at timestamp
+);
 
 -- just a dummy table that we can run SQL on through a layer of middleware
 CREATE TABLE middleware_test_recs (
@@ -394,6 +405,102 @@ CREATE TABLE double_references (
     sekey2 int NOT NULL REFERENCES small_entities(id) ON UPDATE CASCADE
 );
 
+-- for testing that InsertXGraph rolls back when a child can't be inserted
+CREATE TABLE graph_parents (
+    id SERIAL PRIMARY KEY,
+    value text NOT NULL
+);
+CREATE TABLE graph_children (
+    id SERIAL PRIMARY KEY,
+    graph_parent_id integer NOT NULL REFERENCES graph_parents(id),
+    value text NOT NULL UNIQUE
+);
+
+-- many-to-many relationships through join tables
+CREATE TABLE members (
+    id SERIAL PRIMARY KEY,
+    name text NOT NULL
+);
+CREATE TABLE teams (
+    id SERIAL PRIMARY KEY,
+    name text NOT NULL,
+    deleted_at timestamp
+);
+CREATE TABLE team_memberships ( -- a pure join table, so the relationship is infered
+    member_id integer NOT NULL REFERENCES members(id),
+    team_id integer NOT NULL REFERENCES teams(id),
+    created_at timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (member_id, team_id)
+);
+CREATE TABLE team_leads ( -- has an extra column, so must be explicitly configured
+    id SERIAL PRIMARY KEY,
+    lead_id integer NOT NULL REFERENCES members(id),
+    team_id integer NOT NULL REFERENCES teams(id),
+    title text
+);
+
+-- for testing `audit = true`. The history table and trigger are what pggen writes
+-- to models/audited_entities_history.sql. TestAuditMigrationMatchesTestDB in the gen
+-- package fails if they fall out of sync.
+CREATE TABLE audited_entities (
+    id SERIAL PRIMARY KEY,
+    value text NOT NULL,
+    deleted_at timestamp
+);
+CREATE TABLE IF NOT EXISTS audited_entities_history (
+    history_id bigserial PRIMARY KEY,
+    record_id integer NOT NULL,
+    op text NOT NULL,
+    before jsonb,
+    after jsonb,
+    actor text,
+    changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audited_entities_history_record_id_idx
+    ON audited_entities_history (record_id, history_id);
+
+CREATE OR REPLACE FUNCTION audited_entities_history_trigger() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO audited_entities_history (record_id, op, before, after, actor)
+        VALUES (
+            NEW."id",
+            'insert',
+            NULL,
+            to_jsonb(NEW),
+            NULLIF(current_setting('pggen.audit_actor', true), '')
+        );
+        RETURN NEW;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO audited_entities_history (record_id, op, before, after, actor)
+        VALUES (
+            NEW."id",
+            'update',
+            to_jsonb(OLD),
+            to_jsonb(NEW),
+            NULLIF(current_setting('pggen.audit_actor', true), '')
+        );
+        RETURN NEW;
+    ELSE
+        INSERT INTO audited_entities_history (record_id, op, before, after, actor)
+        VALUES (
+            OLD."id",
+            'delete',
+            to_jsonb(OLD),
+            NULL,
+            NULLIF(current_setting('pggen.audit_actor', true), '')
+        );
+        RETURN OLD;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audited_entities_history_trigger ON "audited_entities";
+CREATE TRIGGER audited_entities_history_trigger
+    AFTER INSERT OR UPDATE OR DELETE ON "audited_entities"
+    FOR EACH ROW EXECUTE PROCEDURE audited_entities_history_trigger();
+
 --
 -- Load Data
 --
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opendoor/pggen"
+	"github.com/opendoor/pggen/cmd/pggen/test/jsontypes"
+	"github.com/opendoor/pggen/cmd/pggen/test/models"
+)
+
+func skipUnlessPgxDriver(t *testing.T) {
+	dbDriver := os.Getenv("DB_DRIVER")
+	if dbDriver != "" && dbDriver != "pgx" {
+		t.Skipf("listening requires the pgx driver, testing against '%s'", dbDriver)
+	}
+}
+
+func recvSomeData(t *testing.T, values <-chan jsontypes.SomeData) jsontypes.SomeData {
+	select {
+	case value, ok := <-values:
+		if !ok {
+			t.Fatal("listen channel closed unexpectedly")
+		}
+		return value
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a notification")
+	}
+	return jsontypes.SomeData{}
+}
+
+func TestListenNotify(t *testing.T) {
+	skipUnlessPgxDriver(t)
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values, err := pgClient.ListenSomeDataEvents(listenCtx)
+	chkErr(t, err)
+
+	bar := 3
+	err = pgClient.NotifySomeDataEvents(ctx, jsontypes.SomeData{Foo: "direct", Bar: &bar})
+	chkErr(t, err)
+	value := recvSomeData(t, values)
+	if value.Foo != "direct" || value.Bar == nil || *value.Bar != 3 {
+		t.Fatalf("unexpected payload: %v", value)
+	}
+
+	// notifications sent in a transaction only arrive after it commits
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	err = txClient.NotifySomeDataEvents(ctx, jsontypes.SomeData{Foo: "rolled back"})
+	chkErr(t, err)
+	chkErr(t, txClient.Rollback())
+	err = pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		return tx.NotifySomeDataEvents(ctx, jsontypes.SomeData{Foo: "committed"})
+	})
+	chkErr(t, err)
+	value = recvSomeData(t, values)
+	if value.Foo != "committed" {
+		t.Fatalf("expected the committed payload, got: %v", value)
+	}
+
+	cancel()
+	for range values {
+	}
+}
+
+func TestListenReconnects(t *testing.T) {
+	skipUnlessPgxDriver(t)
+
+	errs := make(chan error, 16)
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values, err := pgClient.ListenSomeDataEvents(listenCtx, pggen.ListenOnError(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+	chkErr(t, err)
+
+	_, err = pgClient.Handle().ExecContext(ctx, `
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE query LIKE 'LISTEN "some_data_events"%' AND pid <> pg_backend_pid()
+	`)
+	chkErr(t, err)
+	select {
+	case <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the dropped connection to be reported")
+	}
+
+	// notifications sent before the listener reconnects are lost, so keep
+	// sending until one makes it through
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case value := <-values:
+			if value.Foo != "after reconnect" {
+				t.Fatalf("unexpected payload: %v", value)
+			}
+			return
+		case <-ticker.C:
+			err = pgClient.NotifySomeDataEvents(ctx, jsontypes.SomeData{Foo: "after reconnect"})
+			chkErr(t, err)
+		case <-deadline:
+			t.Fatal("timed out waiting for the listener to reconnect")
+		}
+	}
+}
@@ -3,10 +3,12 @@ package test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"reflect"
 	"testing"
 
 	"github.com/opendoor/pggen"
+	"github.com/opendoor/pggen/cmd/pggen/test/models"
 	"github.com/opendoor/pggen/middleware"
 )
 
@@ -147,3 +149,87 @@ func TestBeginTxMiddleware(t *testing.T) {
 		t.Fatal("not called")
 	}
 }
+
+var errDuplicateSmallEntity = errors.New("that small entity already exists")
+
+func TestErrorConverterConstraintViolation(t *testing.T) {
+	dbConn := pgClient.Handle().(pggen.DBConn)
+	wrappedDBConn := middleware.NewDBConnWrapper(dbConn).WithErrorConverter(func(err error) error {
+		violation, is := pggen.AsConstraintViolation(err)
+		if is && violation.Constraint == models.SmallEntityPkeyConstraint {
+			return errDuplicateSmallEntity
+		}
+		return err
+	})
+	client := models.NewPGClient(wrappedDBConn)
+
+	txClient, err := client.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	id, err := txClient.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 1})
+	chkErr(t, err)
+
+	_, err = txClient.InsertSmallEntity(
+		ctx, &models.SmallEntity{Id: id, Anint: 2}, pggen.InsertUsePkey)
+	if err != errDuplicateSmallEntity {
+		t.Fatalf("expected the violation to be converted, got: %v", err)
+	}
+}
+
+func TestReplicaRouting(t *testing.T) {
+	dbConn := pgClient.Handle().(pggen.DBConn)
+	replicaQueries := 0
+	replica := middleware.NewDBConnWrapper(dbConn).WithQueryMiddleware(
+		func(queryFunc middleware.QueryFunc) middleware.QueryFunc {
+			return func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+				replicaQueries++
+				return queryFunc(ctx, query, args...)
+			}
+		},
+	)
+	client := models.NewPGClientWithReplicas(dbConn, replica)
+
+	// writes go to the primary
+	id, err := client.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 1})
+	chkErr(t, err)
+	defer func() {
+		err := client.DeleteSmallEntity(ctx, id)
+		chkErr(t, err)
+	}()
+	if replicaQueries != 0 {
+		t.Fatalf("expected the insert to go to the primary, got %d replica queries", replicaQueries)
+	}
+
+	// reads go to the replica
+	_, err = client.GetSmallEntity(ctx, id)
+	chkErr(t, err)
+	_, err = client.ListSmallEntity(ctx, []int64{id})
+	chkErr(t, err)
+	_, err = client.GetSmallEntityReadOnly(ctx)
+	chkErr(t, err)
+	if replicaQueries != 3 {
+		t.Fatalf("expected 3 replica queries, got %d", replicaQueries)
+	}
+
+	// unless the caller asks for the primary, or they are not marked read only
+	_, err = client.GetSmallEntity(pggen.UsePrimary(ctx), id)
+	chkErr(t, err)
+	_, err = client.GetSmallEntity1(ctx)
+	chkErr(t, err)
+	if replicaQueries != 3 {
+		t.Fatalf("expected 3 replica queries, got %d", replicaQueries)
+	}
+
+	// reads within a transaction stay within the transaction
+	err = client.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		_, err := tx.GetSmallEntity(ctx, id)
+		return err
+	})
+	chkErr(t, err)
+	if replicaQueries != 3 {
+		t.Fatalf("expected 3 replica queries, got %d", replicaQueries)
+	}
+}
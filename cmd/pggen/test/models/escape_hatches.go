@@ -23,7 +23,8 @@ func (p *PGClient) ClearCaches() {
 	emptySliceV := reflect.ValueOf(emptySlice)
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
-		if field.Type().Kind() != reflect.Slice {
+		// only the column index tables are caches
+		if field.Type() != emptySliceV.Type() {
 			continue
 		}
 
@@ -0,0 +1,6 @@
+package pgx_models
+
+// make sure that the schema is in place
+//go:generate go run ../../../../tools/ensure-schema/main.go ../db.sql
+
+//go:generate go run ./../../main.go -o models.gen.go pggen.toml
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/opendoor/pggen"
+	"github.com/opendoor/pggen/cmd/pggen/test/pgx_models"
+)
+
+func TestPgxBackend(t *testing.T) {
+	conn, err := pgx.Connect(ctx, dbURL)
+	chkErr(t, err)
+	defer conn.Close(ctx) // nolint: errcheck
+	client := pgx_models.NewPGClient(conn)
+
+	txClient, err := client.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	id, err := txClient.InsertSmallEntity(ctx, &pgx_models.SmallEntity{Anint: 1923})
+	chkErr(t, err)
+	fetched, err := txClient.GetSmallEntity(ctx, id)
+	chkErr(t, err)
+	if fetched.Anint != 1923 {
+		t.Fatalf("expected to fetch the inserted record, got: %v", fetched)
+	}
+
+	_, err = txClient.UpdateSmallEntity(
+		ctx, &pgx_models.SmallEntity{Id: id, Anint: 1924}, pgx_models.SmallEntityAllFields)
+	chkErr(t, err)
+	byAnint, err := txClient.GetSmallEntitiesByAnint(ctx, 1924)
+	chkErr(t, err)
+	if len(byAnint) != 1 || byAnint[0].Id != id {
+		t.Fatalf("expected to query the updated record, got: %v", byAnint)
+	}
+
+	res, err := txClient.DeleteSmallEntitiesByAnint(ctx, 1924)
+	chkErr(t, err)
+	nrows, err := res.RowsAffected()
+	chkErr(t, err)
+	if nrows != 1 {
+		t.Fatalf("expected to delete 1 row, deleted %d", nrows)
+	}
+	_, err = txClient.GetSmallEntity(ctx, id)
+	if !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected the record to be deleted, got: %v", err)
+	}
+}
+
+func TestPgxBackendErrors(t *testing.T) {
+	conn, err := pgx.Connect(ctx, dbURL)
+	chkErr(t, err)
+	defer conn.Close(ctx) // nolint: errcheck
+	client := pgx_models.NewPGClient(conn)
+
+	err = client.WithTx(ctx, nil, func(tx *pgx_models.TxPGClient) error {
+		id, err := tx.InsertSmallEntity(ctx, &pgx_models.SmallEntity{Anint: 1})
+		chkErr(t, err)
+		_, err = tx.InsertSmallEntity(
+			ctx, &pgx_models.SmallEntity{Id: id, Anint: 2}, pggen.InsertUsePkey)
+		return err
+	})
+	violation, is := pggen.AsConstraintViolation(err)
+	if !is || violation.Constraint != pgx_models.SmallEntityPkeyConstraint {
+		t.Fatalf("expected a primary key violation, got: %v", err)
+	}
+}
+
+func TestPgxBatch(t *testing.T) {
+	conn, err := pgx.Connect(ctx, dbURL)
+	chkErr(t, err)
+	defer conn.Close(ctx) // nolint: errcheck
+	client := pgx_models.NewPGClient(conn)
+
+	txClient, err := client.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	for i := 0; i < 2; i++ {
+		_, err = txClient.InsertSmallEntity(ctx, &pgx_models.SmallEntity{Anint: 1925})
+		chkErr(t, err)
+	}
+
+	batch := txClient.Batch()
+	byAnint := batch.QueueGetSmallEntitiesByAnint(1925)
+	count := batch.QueueCountSmallEntitiesByAnint(1925)
+	_, err = count.Get()
+	if err == nil {
+		t.Fatal("expected getting the result of an unsent batch to fail")
+	}
+
+	chkErr(t, batch.Send(ctx))
+	entities, err := byAnint.Get()
+	chkErr(t, err)
+	if len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(entities))
+	}
+	n, err := count.Get()
+	chkErr(t, err)
+	if n != 2 {
+		t.Fatalf("expected a count of 2, got %d", n)
+	}
+
+	if batch.Send(ctx) == nil {
+		t.Fatal("expected sending a batch twice to fail")
+	}
+	_, err = batch.QueueCountSmallEntitiesByAnint(1925).Get()
+	if err == nil {
+		t.Fatal("expected queueing on a sent batch to fail")
+	}
+}
+
+func TestPgxListenNotify(t *testing.T) {
+	conn, err := pgx.Connect(ctx, dbURL)
+	chkErr(t, err)
+	defer conn.Close(ctx) // nolint: errcheck
+	client := pgx_models.NewPGClient(conn)
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	values, err := client.ListenSmallEntityEvents(listenCtx)
+	chkErr(t, err)
+
+	// the listener gets its own connection, so the client's connection is
+	// still free to send notifications
+	err = client.NotifySmallEntityEvents(ctx, pgx_models.SmallEntity{Id: 7, Anint: 1926})
+	chkErr(t, err)
+	select {
+	case value := <-values:
+		if value.Id != 7 || value.Anint != 1926 {
+			t.Fatalf("unexpected payload: %v", value)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a notification")
+	}
+
+	cancel()
+	for range values {
+	}
+}
@@ -308,3 +308,130 @@ func TestIntervalEcho(t *testing.T) {
 		t.Fatalf("bad result, actual = %s", res)
 	}
 }
+
+func TestInferredNullability(t *testing.T) {
+	rows, err := pgClient.InferredNullability(ctx)
+	chkErr(t, err)
+
+	for _, row := range rows {
+		// assigning to a value type checks that the field is not boxed
+		var notNull string = row.TextFieldNotNull
+		if notNull == "" {
+			t.Fatal("expected a value")
+		}
+
+		// both of these should remain boxed
+		var nullable *string = row.TextField
+		var expr *string = row.Expr
+		_, _ = nullable, expr
+	}
+
+	outerJoined, err := pgClient.InferredNullabilityOuterJoin(ctx)
+	chkErr(t, err)
+	for _, v := range outerJoined {
+		var boxed *string = v
+		_ = boxed
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	_, err = txClient.StmtInsertSmallEntity(ctx, 1917)
+	chkErr(t, err)
+
+	_, err = txClient.UpdateAnintByNamedArgs(ctx, 1918, 1917)
+	chkErr(t, err)
+
+	entities, err := txClient.GetSmallEntitiesByNamedArgs(ctx, 1918, -1)
+	chkErr(t, err)
+	if len(entities) != 1 {
+		t.Fatalf("expected 1 entity, got %d", len(entities))
+	}
+
+	byID, err := txClient.GetSmallEntitiesByNamedArgs(ctx, -1, entities[0].Id)
+	chkErr(t, err)
+	if len(byID) != 1 || byID[0].Anint != 1918 {
+		t.Fatalf("unexpected entities: %v", byID)
+	}
+}
+
+func TestSliceAndOptionalArgs(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	ids, err := txClient.BulkInsertSmallEntity(ctx, []models.SmallEntity{
+		{Anint: 2010},
+		{Anint: 2010},
+		{Anint: 2011},
+	})
+	chkErr(t, err)
+
+	type testCase struct {
+		ids      []int64
+		anint    *int64
+		expected int
+	}
+	anint := int64(2010)
+	cases := []testCase{
+		{ids: ids, anint: nil, expected: 3},
+		{ids: ids[:1], anint: nil, expected: 1},
+		{ids: ids, anint: &anint, expected: 2},
+		{ids: ids[2:], anint: &anint, expected: 0},
+		{ids: []int64{}, anint: nil, expected: 0},
+	}
+	for i, c := range cases {
+		entities, err := txClient.FilterSmallEntities(ctx, c.ids, c.anint)
+		chkErr(t, err)
+		if len(entities) != c.expected {
+			t.Fatalf("%d: expected %d entities, got %d", i, c.expected, len(entities))
+		}
+	}
+
+	// with no ids filter, we should see at least the entities we inserted
+	entities, err := txClient.FilterSmallEntities(ctx, nil, &anint)
+	chkErr(t, err)
+	if len(entities) < 2 {
+		t.Fatalf("expected at least 2 entities, got %d", len(entities))
+	}
+}
+
+func TestArgsStruct(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	ids, err := txClient.BulkInsertSmallEntity(ctx, []models.SmallEntity{
+		{Anint: 3010},
+		{Anint: 3020},
+		{Anint: 3030},
+	})
+	chkErr(t, err)
+
+	_, err = txClient.SetAnintByID(ctx, models.SetAnintByIDParams{
+		Id:    ids[2],
+		Anint: 3015,
+	})
+	chkErr(t, err)
+
+	entities, err := txClient.SmallEntitiesInRange(ctx, models.SmallEntitiesInRangeParams{
+		Lo: 3010,
+		Hi: 3020,
+	})
+	chkErr(t, err)
+	if len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(entities))
+	}
+	if entities[0].Id != ids[0] || entities[1].Id != ids[2] {
+		t.Fatalf("unexpected entities: %v", entities)
+	}
+}
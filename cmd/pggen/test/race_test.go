@@ -5,6 +5,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/opendoor/pggen"
 	"github.com/opendoor/pggen/cmd/pggen/test/models"
 )
 
@@ -74,3 +75,71 @@ func TestOffsetTableFilling(t *testing.T) {
 	`)
 	chkErr(t, err)
 }
+
+func TestConcurrentFillIncludes(t *testing.T) {
+	// concurrent filling only kicks in for a connection pool, so we can't
+	// use a transaction to clean up after ourselves.
+	entityID, err := pgClient.InsertSmallEntity(ctx, &models.SmallEntity{
+		Anint: 4242,
+	})
+	chkErr(t, err)
+	defer func() {
+		_, err := pgClient.Handle().ExecContext(ctx, `
+		DELETE FROM attachments WHERE small_entity_id = $1;
+		DELETE FROM single_attachments WHERE small_entity_id = $1;
+		DELETE FROM nullable_attachments WHERE small_entity_id = $1;
+		DELETE FROM small_entities WHERE id = $1;
+		`, entityID)
+		chkErr(t, err)
+	}()
+
+	for i := 0; i < 5; i++ {
+		_, err = pgClient.InsertAttachment(ctx, &models.Attachment{
+			SmallEntityId: entityID,
+		})
+		chkErr(t, err)
+		_, err = pgClient.InsertNullableAttachment(ctx, &models.NullableAttachment{
+			SmallEntityId: &entityID,
+			Value:         fmt.Sprintf("nullable %d", i),
+		})
+		chkErr(t, err)
+	}
+	_, err = pgClient.InsertSingleAttachment(ctx, &models.SingleAttachment{
+		SmallEntityId: entityID,
+	})
+	chkErr(t, err)
+
+	wg := sync.WaitGroup{}
+	nfillers := 10
+	errchan := make(chan error, nfillers)
+	for i := 0; i < nfillers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			entity, err := pgClient.GetSmallEntity(ctx, entityID)
+			if err != nil {
+				errchan <- err
+				return
+			}
+			err = pgClient.SmallEntityFillIncludes(
+				ctx, entity, models.SmallEntityAllIncludes, pggen.IncludeConcurrently(4))
+			if err != nil {
+				errchan <- err
+				return
+			}
+
+			if len(entity.Attachments) != 5 ||
+				len(entity.NullableAttachments) != 5 ||
+				entity.SingleAttachment == nil {
+				errchan <- fmt.Errorf("incomplete fill: %v", entity)
+				return
+			}
+		}()
+	}
+	wg.Wait()
+	close(errchan)
+	for err := range errchan {
+		chkErr(t, err)
+	}
+}
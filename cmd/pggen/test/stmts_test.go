@@ -49,5 +49,42 @@ func TestEnumInsertStatement(t *testing.T) {
 	chkErr(t, err)
 }
 
+func TestReturningStatements(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	entity, nrows, err := txClient.InsertSmallEntityReturning(ctx, 4010)
+	chkErr(t, err)
+	if nrows != 1 {
+		t.Fatalf("expected 1 row to be affected (actually %d)", nrows)
+	}
+	if entity.Anint != 4010 {
+		t.Fatalf("unexpected entity (Anint = %d)", entity.Anint)
+	}
+
+	_, _, err = txClient.InsertSmallEntityReturning(ctx, 4010)
+	chkErr(t, err)
+
+	// RETURNING columns that come straight from NOT NULL columns are not boxed
+	var ids []int64
+	ids, nrows, err = txClient.BumpAnintReturning(ctx, 4010)
+	chkErr(t, err)
+	if nrows != 2 || len(ids) != 2 {
+		t.Fatalf("expected 2 rows to be affected (actually %d)", nrows)
+	}
+	if ids[0] != entity.Id && ids[1] != entity.Id {
+		t.Fatalf("expected %d to be among the bumped ids %v", entity.Id, ids)
+	}
+
+	ids, nrows, err = txClient.BumpAnintReturning(ctx, 4010)
+	chkErr(t, err)
+	if nrows != 0 || len(ids) != 0 {
+		t.Fatalf("expected no rows to be affected (actually %d)", nrows)
+	}
+}
+
 // TODO: once #20 is done, test inserting null enum values using the
 //       NullEnumType generated type
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -1036,6 +1037,50 @@ func TestIncludeCustomNames(t *testing.T) {
 	}
 }
 
+func TestValidateIncludes(t *testing.T) {
+	err := models.ValidateSmallEntityIncludes(models.SmallEntityAllIncludes)
+	chkErr(t, err)
+
+	err = models.ValidateSmallEntityIncludes(include.Must(include.Parse(
+		"small_entities.custom_reference_name->alternative_reference_name")))
+	chkErr(t, err)
+
+	type testCase struct {
+		spec string
+		err  string
+	}
+	cases := []testCase{
+		{
+			spec: "small_entities.attachmentz",
+			err:  "table 'small_entities' has no reference named 'attachmentz'",
+		},
+		{
+			spec: "small_entities.custom_reference_name",
+			err:  "refers to the 'alternative_reference_name' table",
+		},
+		{
+			spec: "attachments.small_entities",
+			err:  "expected a spec for 'small_entities', got 'attachments'",
+		},
+	}
+
+	for i, c := range cases {
+		spec := include.Must(include.Parse(c.spec))
+
+		err = models.ValidateSmallEntityIncludes(spec)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("case %d: expected error containing '%s', got %v", i, c.err, err)
+		}
+
+		// filling in an invalid spec reports the same error rather than
+		// silently loading nothing.
+		err = pgClient.SmallEntityFillIncludes(ctx, &models.SmallEntity{}, spec)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("case %d: expected fill error containing '%s', got %v", i, c.err, err)
+		}
+	}
+}
+
 func TestParentPointers(t *testing.T) {
 	txClient, err := pgClient.BeginTx(ctx, nil)
 	chkErr(t, err)
@@ -1394,3 +1439,452 @@ func TestMultiRef(t *testing.T) {
 		t.Fatal("expected 2")
 	}
 }
+
+func TestHasManyThrough(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	aliceID, err := txClient.InsertMember(ctx, &models.Member{Name: "alice"})
+	chkErr(t, err)
+	bobID, err := txClient.InsertMember(ctx, &models.Member{Name: "bob"})
+	chkErr(t, err)
+	redID, err := txClient.InsertTeam(ctx, &models.Team{Name: "red"})
+	chkErr(t, err)
+	blueID, err := txClient.InsertTeam(ctx, &models.Team{Name: "blue"})
+	chkErr(t, err)
+
+	_, err = txClient.AddTeamMembership(ctx, aliceID, redID)
+	chkErr(t, err)
+	_, err = txClient.AddTeamMembership(ctx, aliceID, blueID)
+	chkErr(t, err)
+	_, err = txClient.AddTeamMembership(ctx, bobID, redID)
+	chkErr(t, err)
+	_, err = txClient.AddTeamLead(ctx, bobID, redID)
+	chkErr(t, err)
+
+	// soft deleted teams are not loaded
+	err = txClient.DeleteTeam(ctx, blueID)
+	chkErr(t, err)
+
+	members, err := txClient.ListMember(ctx, []int64{aliceID, bobID})
+	chkErr(t, err)
+	memberPtrs := []*models.Member{&members[0], &members[1]}
+	err = txClient.MemberBulkFillIncludes(ctx, memberPtrs, include.Must(include.Parse("members.teams.members")))
+	chkErr(t, err)
+
+	for _, m := range memberPtrs {
+		if len(m.Teams) != 1 || m.Teams[0].Name != "red" {
+			t.Fatalf("%s: expected to be on exactly the red team, got %v", m.Name, m.Teams)
+		}
+		if len(m.Teams[0].Members) != 2 {
+			t.Fatalf("expected the red team to have 2 members, got %d", len(m.Teams[0].Members))
+		}
+	}
+	// the team record is shared between the two members
+	if memberPtrs[0].Teams[0] != memberPtrs[1].Teams[0] {
+		t.Fatal("expected team records to be shared")
+	}
+
+	red, err := txClient.GetTeam(ctx, redID)
+	chkErr(t, err)
+	err = txClient.TeamFillIncludes(ctx, red, include.Must(include.Parse("teams.leads->members")))
+	chkErr(t, err)
+	if len(red.Leads) != 1 || red.Leads[0].Id != bobID {
+		t.Fatalf("expected bob to be the only lead, got %v", red.Leads)
+	}
+	if red.Members != nil {
+		t.Fatal("expected members not to be filled")
+	}
+}
+
+func TestGetAndListWithIncludes(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	aliceID, err := txClient.InsertMember(ctx, &models.Member{Name: "alice"})
+	chkErr(t, err)
+	bobID, err := txClient.InsertMember(ctx, &models.Member{Name: "bob"})
+	chkErr(t, err)
+	redID, err := txClient.InsertTeam(ctx, &models.Team{Name: "red"})
+	chkErr(t, err)
+	_, err = txClient.AddTeamMembership(ctx, aliceID, redID)
+	chkErr(t, err)
+	_, err = txClient.AddTeamMembership(ctx, bobID, redID)
+	chkErr(t, err)
+
+	red, err := txClient.GetTeam(
+		ctx, redID, pggen.GetWithIncludes(include.Must(include.Parse("teams.members"))))
+	chkErr(t, err)
+	if len(red.Members) != 2 {
+		t.Fatalf("expected the red team to have 2 members, got %d", len(red.Members))
+	}
+
+	members, err := txClient.ListMember(
+		ctx,
+		[]int64{aliceID, bobID},
+		pggen.ListWithIncludes(include.Must(include.Parse("members.teams.members"))),
+	)
+	chkErr(t, err)
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(members))
+	}
+	for i := range members {
+		if len(members[i].Teams) != 1 || members[i].Teams[0].Name != "red" {
+			t.Fatalf("%s: expected to be on exactly the red team", members[i].Name)
+		}
+	}
+	// the records we fetched are the same ones that the fill attached to the team
+	for _, m := range members[0].Teams[0].Members {
+		if m != &members[0] && m != &members[1] {
+			t.Fatal("expected the listed members to be shared with the filled team")
+		}
+	}
+
+	_, err = txClient.GetTeam(
+		ctx, redID, pggen.GetWithIncludes(include.Must(include.Parse("teams.memberz"))))
+	if err == nil || !strings.Contains(err.Error(), "no reference named 'memberz'") {
+		t.Fatalf("expected an unknown reference error, got %v", err)
+	}
+}
+
+func TestInsertGraph(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	value := "graph"
+	entity := models.SmallEntity{
+		Anint: 8810,
+		Attachments: []*models.Attachment{
+			{Value: &value},
+			{Value: &value},
+		},
+		SingleAttachment: &models.SingleAttachment{},
+		NullableAttachments: []*models.NullableAttachment{
+			{Value: "nullable"},
+		},
+	}
+	spec := include.Must(include.Parse("small_entities.{attachments, single_attachments, nullable_attachments}"))
+
+	id, err := txClient.InsertSmallEntityGraph(ctx, &entity, spec)
+	chkErr(t, err)
+	if entity.Id != id {
+		t.Fatalf("expected the primary key to be filled in (%d != %d)", entity.Id, id)
+	}
+	for _, a := range entity.Attachments {
+		if a.SmallEntityId != id {
+			t.Fatalf("expected attachment to point at %d, got %d", id, a.SmallEntityId)
+		}
+	}
+	if *entity.NullableAttachments[0].SmallEntityId != id {
+		t.Fatal("expected nullable attachment to point at the entity")
+	}
+
+	loaded, err := txClient.GetSmallEntity(ctx, id, pggen.GetWithIncludes(spec))
+	chkErr(t, err)
+	if len(loaded.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(loaded.Attachments))
+	}
+	if loaded.SingleAttachment == nil || loaded.SingleAttachment.Id != entity.SingleAttachment.Id {
+		t.Fatal("expected the single attachment to be inserted")
+	}
+	if len(loaded.NullableAttachments) != 1 {
+		t.Fatalf("expected 1 nullable attachment, got %d", len(loaded.NullableAttachments))
+	}
+
+	// children which are not in the include spec are not inserted
+	other := models.SmallEntity{
+		Anint:       8811,
+		Attachments: []*models.Attachment{{Value: &value}},
+	}
+	otherID, err := txClient.InsertSmallEntityGraph(ctx, &other, include.Must(include.Parse("small_entities")))
+	chkErr(t, err)
+	loaded, err = txClient.GetSmallEntity(ctx, otherID, pggen.GetWithIncludes(spec))
+	chkErr(t, err)
+	if len(loaded.Attachments) != 0 {
+		t.Fatalf("expected no attachments, got %d", len(loaded.Attachments))
+	}
+}
+
+func TestInsertGraphOptionsOnlyApplyToRoot(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	// The children get their primary keys from the database even though
+	// the parent is inserted with its own.
+	entity := models.SmallEntity{
+		Id:    987654,
+		Anint: 8812,
+		NullableAttachments: []*models.NullableAttachment{
+			{Value: "first"},
+			{Value: "second"},
+		},
+	}
+	id, err := txClient.InsertSmallEntityGraph(
+		ctx,
+		&entity,
+		include.Must(include.Parse("small_entities.nullable_attachments")),
+		pggen.InsertUsePkey,
+	)
+	chkErr(t, err)
+	if id != 987654 {
+		t.Fatalf("expected the given primary key to be used, got %d", id)
+	}
+	if entity.NullableAttachments[0].Id == entity.NullableAttachments[1].Id {
+		t.Fatal("expected the children to get distinct primary keys")
+	}
+}
+
+func TestInsertGraphRollsBack(t *testing.T) {
+	// The children have the same value, which must be unique, so inserting
+	// them fails after the parent has already been inserted.
+	parent := models.GraphParent{
+		Value: "rolled back parent",
+		GraphChildren: []*models.GraphChild{
+			{Value: "duplicate child"},
+			{Value: "duplicate child"},
+		},
+	}
+	_, err := pgClient.InsertGraphParentGraph(
+		ctx,
+		&parent,
+		include.Must(include.Parse("graph_parents.graph_children")),
+	)
+	if err == nil {
+		t.Fatal("expected inserting duplicate children to fail")
+	}
+
+	_, err = pgClient.GetGraphParent(ctx, parent.Id)
+	if !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected the parent insert to be rolled back, got err = %v", err)
+	}
+}
+
+func TestIncludeModifiers(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	entityIDs, err := txClient.BulkInsertSmallEntity(ctx, []models.SmallEntity{
+		{Anint: 1}, {Anint: 2},
+	})
+	chkErr(t, err)
+
+	values := []string{"a", "c", "b"}
+	for _, id := range entityIDs {
+		for i := range values {
+			_, err = txClient.InsertAttachment(ctx, &models.Attachment{
+				SmallEntityId: id,
+				Value:         &values[i],
+			})
+			chkErr(t, err)
+		}
+		_, err = txClient.InsertAttachment(ctx, &models.Attachment{SmallEntityId: id})
+		chkErr(t, err)
+	}
+
+	entities, err := txClient.ListSmallEntity(ctx, entityIDs)
+	chkErr(t, err)
+	entityPtrs := []*models.SmallEntity{&entities[0], &entities[1]}
+	spec := include.Must(include.Parse(
+		"small_entities.attachments[order=value desc, limit=2, where=has_value]",
+	))
+	err = txClient.SmallEntityBulkFillIncludes(ctx, entityPtrs, spec)
+	chkErr(t, err)
+
+	// the ordering and limit apply to each parent separately
+	for _, e := range entityPtrs {
+		if len(e.Attachments) != 2 {
+			t.Fatalf("expected 2 attachments, got %d", len(e.Attachments))
+		}
+		if *e.Attachments[0].Value != "c" || *e.Attachments[1].Value != "b" {
+			t.Fatalf("unexpected attachments: %s, %s", *e.Attachments[0].Value, *e.Attachments[1].Value)
+		}
+	}
+
+	entity, err := txClient.GetSmallEntity(ctx, entityIDs[0])
+	chkErr(t, err)
+	err = txClient.SmallEntityFillIncludes(
+		ctx, entity, include.Must(include.Parse("small_entities.attachments[where=nope]")))
+	if err == nil || !strings.Contains(err.Error(), "no include predicate named 'nope'") {
+		t.Fatalf("expected unknown predicate error, got: %v", err)
+	}
+
+	err = txClient.SmallEntityFillIncludes(
+		ctx, entity, include.Must(include.Parse("small_entities.attachments[order=bogus]")))
+	if err == nil || !strings.Contains(err.Error(), "unknown column 'bogus'") {
+		t.Fatalf("expected unknown column error, got: %v", err)
+	}
+}
+
+func TestRowLocks(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	id, err := txClient.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 7491})
+	chkErr(t, err)
+
+	_, err = txClient.GetSmallEntity(ctx, id, pggen.GetForUpdate, pggen.GetNoWait)
+	chkErr(t, err)
+	_, err = txClient.ListSmallEntity(ctx, []int64{id}, pggen.ListForShare)
+	chkErr(t, err)
+
+	_, err = pgClient.GetSmallEntity(ctx, id, pggen.GetForUpdate)
+	if err == nil || !strings.Contains(err.Error(), "only be taken within a transaction") {
+		t.Fatalf("expected an error locking outside of a transaction, got: %v", err)
+	}
+
+	_, err = txClient.ListSmallEntity(ctx, []int64{id}, pggen.ListSkipLocked)
+	if err == nil || !strings.Contains(err.Error(), "without a row lock strength") {
+		t.Fatalf("expected an error skipping locked rows without a lock, got: %v", err)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	// the claims need to see each other's records, so the setup must be committed
+	ids, err := pgClient.BulkInsertSmallEntity(ctx, []models.SmallEntity{
+		{Anint: 8317},
+		{Anint: 8317},
+		{Anint: 8317},
+	})
+	chkErr(t, err)
+	defer func() {
+		err := pgClient.BulkDeleteSmallEntity(ctx, ids)
+		chkErr(t, err)
+	}()
+
+	tx1, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = tx1.Rollback()
+	}()
+	tx2, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = tx2.Rollback()
+	}()
+
+	claimed1, err := tx1.ClaimSmallEntity(ctx, 2, "anint = $1", 8317)
+	chkErr(t, err)
+	if len(claimed1) != 2 {
+		t.Fatalf("expected to claim 2 records, claimed %d", len(claimed1))
+	}
+
+	// the second claim skips over the records locked by the first
+	claimed2, err := tx2.ClaimSmallEntity(ctx, 2, "anint = $1", 8317)
+	chkErr(t, err)
+	if len(claimed2) != 1 {
+		t.Fatalf("expected to claim 1 record, claimed %d", len(claimed2))
+	}
+	for _, rec := range claimed1 {
+		if rec.Id == claimed2[0].Id {
+			t.Fatalf("record %d was claimed twice", rec.Id)
+		}
+	}
+
+	_, err = tx2.GetSmallEntity(ctx, claimed1[0].Id, pggen.GetForUpdate, pggen.GetSkipLocked)
+	if err == nil || !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected a locked record to be skipped, got: %v", err)
+	}
+}
+
+func TestListOrderAndMissing(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	ids, err := txClient.BulkInsertSmallEntity(ctx, []models.SmallEntity{
+		{Anint: 1},
+		{Anint: 2},
+		{Anint: 3},
+	})
+	chkErr(t, err)
+
+	// results come back in the order they were asked for
+	reversed := []int64{ids[2], ids[1], ids[0]}
+	entities, err := txClient.ListSmallEntity(ctx, reversed)
+	chkErr(t, err)
+	for i, entity := range entities {
+		if entity.Id != reversed[i] {
+			t.Fatalf("entity %d: expected id %d, got %d", i, reversed[i], entity.Id)
+		}
+	}
+
+	var missing []int64
+	entities, err = txClient.ListSmallEntity(
+		ctx,
+		[]int64{ids[1], 9876543, ids[0]},
+		pggen.ListSucceedOnPartialResults,
+		pggen.ListMissing(&missing),
+	)
+	chkErr(t, err)
+	if len(entities) != 2 || entities[0].Id != ids[1] || entities[1].Id != ids[0] {
+		t.Fatalf("unexpected entities: %v", entities)
+	}
+	if len(missing) != 1 || missing[0] != 9876543 {
+		t.Fatalf("unexpected missing ids: %v", missing)
+	}
+
+	var wrongType []string
+	_, err = txClient.ListSmallEntity(ctx, ids, pggen.ListMissing(&wrongType))
+	if err == nil || !strings.Contains(err.Error(), "ListMissing expects a *[]int64") {
+		t.Fatalf("expected a type error, got: %v", err)
+	}
+
+	entityMap, err := txClient.ListSmallEntityMap(ctx, []int64{ids[2], 9876543})
+	chkErr(t, err)
+	if len(entityMap) != 1 || entityMap[ids[2]].Anint != 3 {
+		t.Fatalf("unexpected map: %v", entityMap)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	id, err := txClient.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 1})
+	chkErr(t, err)
+
+	_, err = txClient.InsertSmallEntity(
+		ctx, &models.SmallEntity{Id: id, Anint: 2}, pggen.InsertUsePkey)
+	if !pggen.IsUniqueViolation(err) {
+		t.Fatalf("expected a unique violation, got: %v", err)
+	}
+	if pggen.ConstraintName(err) != "small_entities_pkey" {
+		t.Fatalf("unexpected constraint name: '%s'", pggen.ConstraintName(err))
+	}
+	if pggen.IsForeignKeyViolation(err) || pggen.IsNotFoundError(err) {
+		t.Fatal("a unique violation should only be classified as a unique violation")
+	}
+
+	violation, is := pggen.AsConstraintViolation(err)
+	if !is {
+		t.Fatalf("expected a constraint violation error, got: %v", err)
+	}
+	if violation.Table != "small_entities" ||
+		violation.Constraint != models.SmallEntityPkeyConstraint ||
+		len(violation.Columns) != 1 || violation.Columns[0] != "id" {
+		t.Fatalf("unexpected violation: %#v", violation)
+	}
+}
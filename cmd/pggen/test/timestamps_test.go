@@ -8,6 +8,7 @@ import (
 	"github.com/opendoor/pggen"
 	"github.com/opendoor/pggen/cmd/pggen/test/global_ts_models"
 	"github.com/opendoor/pggen/cmd/pggen/test/models"
+	"github.com/opendoor/pggen/include"
 )
 
 func TestTimestampsBoth(t *testing.T) {
@@ -399,6 +400,241 @@ func TestSoftDeleteIncludes(t *testing.T) {
 	}
 }
 
+func TestDeleteCascade(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	rootID, err := txClient.InsertSoftDeletable(ctx, &models.SoftDeletable{
+		Value: "root",
+	})
+	chkErr(t, err)
+
+	leafIDs := []int64{}
+	for _, value := range []string{"leaf-1", "leaf-2"} {
+		leafID, err := txClient.InsertDeletableLeaf(ctx, &models.DeletableLeaf{
+			Value:           value,
+			SoftDeletableId: rootID,
+		})
+		chkErr(t, err)
+		leafIDs = append(leafIDs, leafID)
+	}
+
+	cascade := include.Must(include.Parse("soft_deletables.deletable_leafs"))
+
+	// the leafs are soft deleted along with the root
+	err = txClient.DeleteSoftDeletable(ctx, rootID, pggen.DeleteCascade(cascade))
+	chkErr(t, err)
+
+	for _, leafID := range leafIDs {
+		_, err = txClient.GetDeletableLeaf(ctx, leafID)
+		if err == nil || !pggen.IsNotFoundError(err) {
+			t.Fatalf("expected leaf %d to be deleted", leafID)
+		}
+	}
+
+	// a hard delete would violate the foreign key if the (soft deleted)
+	// leafs were not removed as well
+	err = txClient.DeleteSoftDeletable(
+		ctx, rootID, pggen.DeleteCascade(cascade), pggen.DeleteDoHardDelete)
+	chkErr(t, err)
+
+	sneakyFetched, err := txClient.GetSoftDeletableAnyway(ctx, rootID)
+	chkErr(t, err)
+	if len(sneakyFetched) != 0 {
+		t.Fatal("expected the root to be proper gone")
+	}
+
+	// only references from child tables may be cascaded through
+	err = txClient.DeleteDeletableLeaf(
+		ctx,
+		leafIDs[0],
+		pggen.DeleteCascade(include.Must(include.Parse("deletable_leafs.soft_deletables"))),
+	)
+	if err == nil {
+		t.Fatal("expected an error cascading to a parent table")
+	}
+}
+
+func TestDeleteCascadeHardDeletesChildrenOfHardDeletedParents(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	rootID, err := txClient.InsertHardDeletable(ctx, &models.HardDeletable{
+		Value: "root",
+	})
+	chkErr(t, err)
+
+	leafIDs := []int64{}
+	for _, value := range []string{"leaf-1", "leaf-2"} {
+		leafID, err := txClient.InsertSoftDeletableLeaf(ctx, &models.SoftDeletableLeaf{
+			Value:           value,
+			HardDeletableId: rootID,
+		})
+		chkErr(t, err)
+		leafIDs = append(leafIDs, leafID)
+	}
+
+	err = txClient.DeleteSoftDeletableLeaf(ctx, leafIDs[0])
+	chkErr(t, err)
+
+	// the root can only be hard deleted, so the already soft deleted leaf
+	// must be hard deleted along with the other one
+	err = txClient.DeleteHardDeletable(
+		ctx,
+		rootID,
+		pggen.DeleteCascade(include.Must(include.Parse("hard_deletables.soft_deletable_leafs"))),
+	)
+	chkErr(t, err)
+
+	for _, leafID := range leafIDs {
+		sneakyFetched, err := txClient.GetSoftDeletableLeafAnyway(ctx, leafID)
+		chkErr(t, err)
+		if len(sneakyFetched) != 0 {
+			t.Fatalf("expected leaf %d to be proper gone", leafID)
+		}
+	}
+}
+
+func TestDeleteCascadeCyclicSpec(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	cycle1ID, err := txClient.InsertCycle1(ctx, &models.Cycle1{
+		Value: "foo",
+	})
+	chkErr(t, err)
+	_, err = txClient.InsertCycle2(ctx, &models.Cycle2{
+		Cycle1Id: cycle1ID,
+		Value:    9,
+	})
+	chkErr(t, err)
+
+	err = txClient.DeleteCycle1(
+		ctx,
+		cycle1ID,
+		pggen.DeleteCascade(include.Must(include.Parse("cycle1.cycle2.cycle1"))),
+	)
+	chkErr(t, err)
+
+	_, err = txClient.GetCycle1(ctx, cycle1ID)
+	if err == nil || !pggen.IsNotFoundError(err) {
+		t.Fatal("expected the root to be deleted")
+	}
+}
+
+func TestRestoreAndIncludeDeleted(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	rootID, err := txClient.InsertSoftDeletable(ctx, &models.SoftDeletable{
+		Value: "root",
+	})
+	chkErr(t, err)
+
+	leafID, err := txClient.InsertDeletableLeaf(ctx, &models.DeletableLeaf{
+		Value:           "leaf",
+		SoftDeletableId: rootID,
+	})
+	chkErr(t, err)
+
+	err = txClient.DeleteDeletableLeaf(ctx, leafID)
+	chkErr(t, err)
+	err = txClient.DeleteSoftDeletable(ctx, rootID)
+	chkErr(t, err)
+
+	//
+	// soft deleted records can still be read if we ask for them
+	//
+
+	root, err := txClient.GetSoftDeletable(ctx, rootID, pggen.GetIncludeDeleted)
+	chkErr(t, err)
+	if root.DeletedTs == nil {
+		t.Fatal("expected the root to be marked deleted")
+	}
+
+	roots, err := txClient.ListSoftDeletable(ctx, []int64{rootID}, pggen.ListIncludeDeleted)
+	chkErr(t, err)
+	if len(roots) != 1 {
+		t.Fatalf("expected one root, got: %v", roots)
+	}
+
+	err = txClient.SoftDeletableFillIncludes(ctx, root, models.SoftDeletableAllIncludes)
+	chkErr(t, err)
+	if len(root.DeletableLeafs) != 0 {
+		t.Fatalf("expected deleted leafs to be left out, got: %v", root.DeletableLeafs)
+	}
+
+	err = txClient.SoftDeletableFillIncludes(
+		ctx, root, models.SoftDeletableAllIncludes, pggen.IncludeDeleted)
+	chkErr(t, err)
+	if len(root.DeletableLeafs) != 1 {
+		t.Fatalf("expected the deleted leaf to be filled, got: %v", root.DeletableLeafs)
+	}
+
+	//
+	// restoring brings them back
+	//
+
+	err = txClient.RestoreSoftDeletable(ctx, rootID)
+	chkErr(t, err)
+	err = txClient.BulkRestoreDeletableLeaf(ctx, []int64{leafID})
+	chkErr(t, err)
+
+	root, err = txClient.GetSoftDeletable(ctx, rootID)
+	chkErr(t, err)
+	if root.DeletedTs != nil {
+		t.Fatal("expected the root to no longer be marked deleted")
+	}
+	_, err = txClient.GetDeletableLeaf(ctx, leafID)
+	chkErr(t, err)
+
+	err = txClient.RestoreSoftDeletable(ctx, rootID+1000)
+	if err == nil || !pggen.IsNotFoundError(err) {
+		t.Fatal("expected restoring a missing record to fail")
+	}
+
+	err = txClient.RestoreSoftDeletable(ctx, rootID)
+	if err == nil || !pggen.IsNotFoundError(err) {
+		t.Fatal("expected restoring a record which is not deleted to fail")
+	}
+
+	//
+	// purging only removes records deleted before the cutoff
+	//
+
+	err = txClient.DeleteDeletableLeaf(ctx, leafID)
+	chkErr(t, err)
+
+	nPurged, err := txClient.PurgeDeletedDeletableLeaf(ctx, time.Now().Add(-time.Hour))
+	chkErr(t, err)
+	if nPurged != 0 {
+		t.Fatalf("expected nothing to be purged, purged %d", nPurged)
+	}
+
+	nPurged, err = txClient.PurgeDeletedDeletableLeaf(ctx, time.Now().Add(time.Hour))
+	chkErr(t, err)
+	if nPurged < 1 {
+		t.Fatalf("expected the leaf to be purged, purged %d", nPurged)
+	}
+
+	_, err = txClient.GetDeletableLeaf(ctx, leafID, pggen.GetIncludeDeleted)
+	if err == nil || !pggen.IsNotFoundError(err) {
+		t.Fatal("expected the leaf to be proper gone")
+	}
+}
+
 func TestGlobalDeletedAt(t *testing.T) {
 	dbClient := global_ts_models.NewPGClient(pgClient.Handle().(*sql.DB))
 	txClient, err := dbClient.BeginTx(ctx, nil)
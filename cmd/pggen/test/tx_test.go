@@ -1,8 +1,13 @@
 package test
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
+	"github.com/jackc/pgconn"
+
+	"github.com/opendoor/pggen"
 	"github.com/opendoor/pggen/cmd/pggen/test/models"
 )
 
@@ -67,3 +72,291 @@ func TestTxCommit(t *testing.T) {
 	err = pgClient.DeleteSmallEntity(ctx, seID)
 	chkErr(t, err)
 }
+
+func TestWithTx(t *testing.T) {
+	var seID int64
+	err := pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		var err error
+		seID, err = tx.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 19})
+		return err
+	})
+	chkErr(t, err)
+
+	_, err = pgClient.GetSmallEntity(ctx, seID)
+	chkErr(t, err)
+	err = pgClient.DeleteSmallEntity(ctx, seID)
+	chkErr(t, err)
+
+	// errors cause a rollback and get passed along
+	errBail := errors.New("bail")
+	err = pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		var err error
+		seID, err = tx.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 19})
+		chkErr(t, err)
+		return errBail
+	})
+	if err != errBail {
+		t.Fatalf("expected the error to be passed along, got: %v", err)
+	}
+	_, err = pgClient.GetSmallEntity(ctx, seID)
+	if !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected the insert to be rolled back, got: %v", err)
+	}
+
+	// so do panics
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the panic to be passed along")
+			}
+		}()
+		_ = pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+			var err error
+			seID, err = tx.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 19})
+			chkErr(t, err)
+			panic("bail")
+		})
+	}()
+	_, err = pgClient.GetSmallEntity(ctx, seID)
+	if !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected the insert to be rolled back, got: %v", err)
+	}
+}
+
+func TestWithTxRetries(t *testing.T) {
+	serializationFailure := &pgconn.PgError{Code: "40001"}
+
+	attempts := 0
+	err := pgClient.WithTx(ctx, &pggen.TxOptions{MaxRetries: 2}, func(tx *models.TxPGClient) error {
+		attempts++
+		if attempts < 3 {
+			return serializationFailure
+		}
+		return nil
+	})
+	chkErr(t, err)
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	// give up once we run out of retries
+	attempts = 0
+	err = pgClient.WithTx(ctx, &pggen.TxOptions{MaxRetries: 2}, func(tx *models.TxPGClient) error {
+		attempts++
+		return serializationFailure
+	})
+	if !pggen.IsSerializationFailure(err) || attempts != 3 {
+		t.Fatalf("expected to give up after 3 attempts, got %d attempts and err: %v", attempts, err)
+	}
+
+	// zero options fall back to the default number of retries
+	attempts = 0
+	err = pgClient.WithTx(ctx, &pggen.TxOptions{Backoff: -1}, func(tx *models.TxPGClient) error {
+		attempts++
+		return serializationFailure
+	})
+	if !pggen.IsSerializationFailure(err) || attempts != pggen.DefaultTxMaxRetries+1 {
+		t.Fatalf(
+			"expected to give up after %d attempts, got %d attempts and err: %v",
+			pggen.DefaultTxMaxRetries+1,
+			attempts,
+			err,
+		)
+	}
+
+	// negative options turn retries off
+	attempts = 0
+	err = pgClient.WithTx(ctx, &pggen.TxOptions{MaxRetries: -1}, func(tx *models.TxPGClient) error {
+		attempts++
+		return serializationFailure
+	})
+	if !pggen.IsSerializationFailure(err) || attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d attempts and err: %v", attempts, err)
+	}
+
+	// other errors are not retried
+	attempts = 0
+	err = pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		attempts++
+		return errors.New("bail")
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d attempts and err: %v", attempts, err)
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	defer func() {
+		_ = txClient.Rollback()
+	}()
+
+	sp, err := txClient.Savepoint(ctx, "my savepoint")
+	chkErr(t, err)
+
+	keptID, err := sp.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 1})
+	chkErr(t, err)
+	chkErr(t, sp.Release(ctx))
+
+	sp, err = txClient.Savepoint(ctx, "my savepoint")
+	chkErr(t, err)
+	droppedID, err := sp.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 2})
+	chkErr(t, err)
+	chkErr(t, sp.RollbackTo(ctx))
+
+	_, err = txClient.GetSmallEntity(ctx, keptID)
+	chkErr(t, err)
+	_, err = txClient.GetSmallEntity(ctx, droppedID)
+	if !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected the insert to be rolled back, got: %v", err)
+	}
+
+	if sp.Commit() == nil || sp.Rollback() == nil {
+		t.Fatal("expected committing or rolling back a savepoint client to fail")
+	}
+	if txClient.Release(ctx) == nil || txClient.RollbackTo(ctx) == nil {
+		t.Fatal("expected releasing a transaction to fail")
+	}
+}
+
+func TestNestedWithTx(t *testing.T) {
+	var outerID, innerID int64
+	err := pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		var err error
+		outerID, err = tx.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 1})
+		chkErr(t, err)
+
+		// a failing nested transaction only undoes its own work, and leaves the
+		// outer transaction usable even though a statement failed
+		err = tx.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+			innerID, err = tx.InsertSmallEntity(ctx, &models.SmallEntity{Anint: 2})
+			chkErr(t, err)
+			_, err = tx.InsertSmallEntity(
+				ctx, &models.SmallEntity{Id: innerID, Anint: 3}, pggen.InsertUsePkey)
+			return err
+		})
+		if !pggen.IsUniqueViolation(err) {
+			t.Fatalf("expected a unique violation, got: %v", err)
+		}
+
+		// a successful nested transaction gets folded into the outer one
+		return tx.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+			_, err := tx.GetSmallEntity(ctx, outerID)
+			return err
+		})
+	})
+	chkErr(t, err)
+
+	_, err = pgClient.GetSmallEntity(ctx, outerID)
+	chkErr(t, err)
+	_, err = pgClient.GetSmallEntity(ctx, innerID)
+	if !pggen.IsNotFoundError(err) {
+		t.Fatalf("expected the nested insert to be rolled back, got: %v", err)
+	}
+
+	err = pgClient.DeleteSmallEntity(ctx, outerID)
+	chkErr(t, err)
+}
+
+func TestTxHooks(t *testing.T) {
+	var ran []string
+	hook := func(name string) func() {
+		return func() {
+			ran = append(ran, name)
+		}
+	}
+
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	txClient.OnCommit(hook("commit"))
+	txClient.OnRollback(hook("rollback"))
+
+	// hooks registered within a savepoint which gets rolled back to are dropped,
+	// except for the rollback hooks which run immediately
+	sp, err := txClient.Savepoint(ctx, "sp")
+	chkErr(t, err)
+	sp.OnCommit(hook("dropped commit"))
+	sp.OnRollback(hook("savepoint rollback"))
+	chkErr(t, sp.RollbackTo(ctx))
+
+	// hooks registered within a released savepoint belong to the transaction
+	sp, err = txClient.Savepoint(ctx, "sp")
+	chkErr(t, err)
+	sp.OnCommit(hook("savepoint commit"))
+	chkErr(t, sp.Release(ctx))
+
+	chkErr(t, txClient.Commit())
+	expected := []string{"savepoint rollback", "commit", "savepoint commit"}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Fatalf("expected %v, got %v", expected, ran)
+	}
+
+	// the hooks only ever run once
+	_ = txClient.Rollback()
+	if !reflect.DeepEqual(ran, expected) {
+		t.Fatalf("expected %v, got %v", expected, ran)
+	}
+
+	ran = nil
+	txClient, err = pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	txClient.OnCommit(hook("commit"))
+	txClient.OnRollback(hook("rollback"))
+	chkErr(t, txClient.Rollback())
+	if !reflect.DeepEqual(ran, []string{"rollback"}) {
+		t.Fatalf("expected only the rollback hook to run, got %v", ran)
+	}
+}
+
+func TestChangeEvents(t *testing.T) {
+	var events []pggen.ChangeEvent
+	listenCtx := pggen.WithChangeListener(ctx, func(event pggen.ChangeEvent) {
+		events = append(events, event)
+	})
+
+	// changes made outside of a transaction are reported immediately
+	seID, err := pgClient.InsertSmallEntity(listenCtx, &models.SmallEntity{Anint: 1})
+	chkErr(t, err)
+	expected := []pggen.ChangeEvent{
+		{Table: "small_entities", Op: pggen.ChangeInsert, IDs: []int64{seID}},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+
+	// changes made within a transaction wait for it to commit
+	err = pgClient.WithTx(ctx, nil, func(tx *models.TxPGClient) error {
+		_, err := tx.UpdateSmallEntity(
+			listenCtx, &models.SmallEntity{Id: seID, Anint: 2}, models.SmallEntityAllFields)
+		chkErr(t, err)
+		if len(events) != 1 {
+			t.Fatalf("expected the update not to be reported yet, got %v", events)
+		}
+		return nil
+	})
+	chkErr(t, err)
+	expected = append(expected,
+		pggen.ChangeEvent{Table: "small_entities", Op: pggen.ChangeUpdate, IDs: []int64{seID}})
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+
+	// and are never reported if it rolls back
+	txClient, err := pgClient.BeginTx(ctx, nil)
+	chkErr(t, err)
+	err = txClient.DeleteSmallEntity(listenCtx, seID)
+	chkErr(t, err)
+	chkErr(t, txClient.Rollback())
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected the rolled back delete not to be reported, got %v", events)
+	}
+
+	err = pgClient.DeleteSmallEntity(listenCtx, seID)
+	chkErr(t, err)
+	expected = append(expected,
+		pggen.ChangeEvent{Table: "small_entities", Op: pggen.ChangeDelete, IDs: []int64{seID}})
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+}
@@ -1,6 +1,12 @@
 package pggen
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+
 	"github.com/opendoor/pggen/unstable"
 )
 
@@ -11,14 +17,19 @@ import (
 // is a not found error returned from pggen. The causal chain is determined
 // by repeatedly calling Unwrap on the error.
 func IsNotFoundError(err error) bool {
-	for {
-		if err == nil {
-			return false
-		}
-
+	return walkCauses(err, func(err error) bool {
 		_, is := err.(*unstable.NotFoundError)
-		if is {
-			return is
+		return is
+	})
+}
+
+// walkCauses calls `fn` on the given error and then on each of its causes in turn,
+// stopping as soon as `fn` returns true. The causal chain is determined by repeatedly
+// calling Unwrap on the error. It returns true if `fn` ever returned true.
+func walkCauses(err error, fn func(error) bool) bool {
+	for err != nil {
+		if fn(err) {
+			return true
 		}
 
 		// we don't use errors.Unwrap in order to maintain our msgv
@@ -30,4 +41,173 @@ func IsNotFoundError(err error) bool {
 		}
 		err = u.Unwrap()
 	}
+	return false
+}
+
+// SQLSTATE codes for the classes of database error that pggen knows how to classify.
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	uniqueViolationCode      = "23505"
+	foreignKeyViolationCode  = "23503"
+	checkViolationCode       = "23514"
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+// IsUniqueViolation returns true if the given error, or any of its causes, is
+// a postgres error indicating that a unique constraint was violated.
+func IsUniqueViolation(err error) bool {
+	return hasPgErrorCode(err, uniqueViolationCode)
+}
+
+// IsForeignKeyViolation returns true if the given error, or any of its causes, is
+// a postgres error indicating that a foreign key constraint was violated.
+func IsForeignKeyViolation(err error) bool {
+	return hasPgErrorCode(err, foreignKeyViolationCode)
+}
+
+// IsCheckViolation returns true if the given error, or any of its causes, is
+// a postgres error indicating that a check constraint was violated.
+func IsCheckViolation(err error) bool {
+	return hasPgErrorCode(err, checkViolationCode)
+}
+
+// IsSerializationFailure returns true if the given error, or any of its causes, is
+// a postgres error indicating that a transaction could not be serialized. Such
+// transactions can generally be retried.
+func IsSerializationFailure(err error) bool {
+	return hasPgErrorCode(err, serializationFailureCode)
+}
+
+// IsDeadlock returns true if the given error, or any of its causes, is a postgres
+// error indicating that the transaction was aborted to break a deadlock. Such
+// transactions can generally be retried.
+func IsDeadlock(err error) bool {
+	return hasPgErrorCode(err, deadlockDetectedCode)
+}
+
+// ConstraintName returns the name of the constraint that the given error, or
+// any of its causes, reports as violated. If there is no such constraint, the
+// empty string is returned.
+func ConstraintName(err error) string {
+	pgErr, _ := findPgError(err)
+	return pgErr.constraint
+}
+
+// ConstraintViolationError is returned by generated code when a query violates
+// a constraint on one of the tables that pggen generated code for. Use
+// AsConstraintViolation to find out if an error is a constraint violation.
+// The underlying driver error is still available via Unwrap, so helpers like
+// IsUniqueViolation keep working.
+type ConstraintViolationError struct {
+	// The name of the table that the constraint is on
+	Table string
+	// The name of the constraint that was violated
+	Constraint string
+	// The names of the columns covered by the constraint
+	Columns []string
+	// The error reported by the database driver
+	Err error
+}
+
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf(
+		"violation of constraint '%s' on table '%s' (columns: %s): %s",
+		e.Constraint,
+		e.Table,
+		strings.Join(e.Columns, ", "),
+		e.Err.Error(),
+	)
+}
+
+func (e *ConstraintViolationError) Unwrap() error {
+	return e.Err
+}
+
+// AsConstraintViolation returns the first constraint violation error in the
+// causal chain of the given error, determined by repeatedly calling Unwrap on
+// the error.
+func AsConstraintViolation(err error) (*ConstraintViolationError, bool) {
+	var violation *ConstraintViolationError
+	found := walkCauses(err, func(err error) bool {
+		var is bool
+		violation, is = err.(*ConstraintViolationError)
+		return is
+	})
+	return violation, found
+}
+
+// WrapConstraintViolation wraps the given error in a ConstraintViolationError if
+// it reports a violation of one of the given constraints. `constraintColumns`
+// maps `<schema>.<table>` to the names of the constraints on the table, and those
+// in turn to the columns they cover. Other errors are returned unchanged.
+//
+// Generated code calls this automatically with the constraints of all the tables
+// that it knows about, so it is only needed for errors returned by hand-written
+// SQL.
+func WrapConstraintViolation(err error, constraintColumns map[string]map[string][]string) error {
+	if err == nil {
+		return nil
+	}
+	if _, alreadyWrapped := AsConstraintViolation(err); alreadyWrapped {
+		return err
+	}
+
+	pgErr, found := findPgError(err)
+	if !found || pgErr.constraint == "" {
+		return err
+	}
+	cols, known := constraintColumns[pgErr.schema+"."+pgErr.table][pgErr.constraint]
+	if !known {
+		return err
+	}
+
+	return &ConstraintViolationError{
+		Table:      pgErr.table,
+		Constraint: pgErr.constraint,
+		Columns:    cols,
+		Err:        err,
+	}
+}
+
+func hasPgErrorCode(err error, code string) bool {
+	pgErr, found := findPgError(err)
+	return found && pgErr.code == code
+}
+
+// pgErrorFields holds the parts of a postgres error that pggen cares about
+type pgErrorFields struct {
+	code       string
+	schema     string
+	table      string
+	constraint string
+}
+
+// findPgError walks the causal chain of the given error looking for an error
+// returned by one of the postgres drivers that pggen supports (jackc/pgx or lib/pq),
+// and returns the fields of it that pggen cares about.
+func findPgError(err error) (pgErrorFields, bool) {
+	var fields pgErrorFields
+	found := walkCauses(err, func(err error) bool {
+		switch pgErr := err.(type) {
+		case *pgconn.PgError:
+			fields = pgErrorFields{
+				code:       pgErr.Code,
+				schema:     pgErr.SchemaName,
+				table:      pgErr.TableName,
+				constraint: pgErr.ConstraintName,
+			}
+			return true
+		case *pq.Error:
+			fields = pgErrorFields{
+				code:       string(pgErr.Code),
+				schema:     pgErr.Schema,
+				table:      pgErr.Table,
+				constraint: pgErr.Constraint,
+			}
+			return true
+		}
+		return false
+	})
+	return fields, found
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+
 	"github.com/opendoor/pggen/unstable"
 )
 
@@ -41,6 +44,169 @@ func TestIsNotFoundError(t *testing.T) {
 	}
 }
 
+func TestPgErrorClassification(t *testing.T) {
+	type testCase struct {
+		err        error
+		is         func(error) bool
+		expected   bool
+		constraint string
+	}
+	cases := []testCase{
+		{
+			err:        &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"},
+			is:         IsUniqueViolation,
+			expected:   true,
+			constraint: "users_email_key",
+		},
+		{
+			err:        &causedErr{cause: &pq.Error{Code: "23505", Constraint: "users_email_key"}},
+			is:         IsUniqueViolation,
+			expected:   true,
+			constraint: "users_email_key",
+		},
+		{
+			err:      &pgconn.PgError{Code: "23505"},
+			is:       IsForeignKeyViolation,
+			expected: false,
+		},
+		{
+			err:        &causedErr{cause: &pgconn.PgError{Code: "23503", ConstraintName: "posts_user_id_fkey"}},
+			is:         IsForeignKeyViolation,
+			expected:   true,
+			constraint: "posts_user_id_fkey",
+		},
+		{
+			err:        &pq.Error{Code: "23514", Constraint: "positive_balance"},
+			is:         IsCheckViolation,
+			expected:   true,
+			constraint: "positive_balance",
+		},
+		{
+			err:      &causedErr{cause: &pgconn.PgError{Code: "40001"}},
+			is:       IsSerializationFailure,
+			expected: true,
+		},
+		{
+			err:      &pq.Error{Code: "40P01"},
+			is:       IsDeadlock,
+			expected: true,
+		},
+		{
+			err:      fmt.Errorf("not a postgres error"),
+			is:       IsUniqueViolation,
+			expected: false,
+		},
+		{
+			err:      &unstable.NotFoundError{Msg: "NotFound"},
+			is:       IsDeadlock,
+			expected: false,
+		},
+	}
+
+	for i, c := range cases {
+		if c.is(c.err) != c.expected {
+			t.Fatalf("case %d: expected %t, got %t", i, c.expected, !c.expected)
+		}
+		if ConstraintName(c.err) != c.constraint {
+			t.Fatalf(
+				"case %d: expected constraint '%s', got '%s'", i, c.constraint, ConstraintName(c.err))
+		}
+	}
+
+	if IsUniqueViolation(nil) || ConstraintName(nil) != "" {
+		t.Fatal("nil errors should not be classified")
+	}
+}
+
+func TestWrapConstraintViolation(t *testing.T) {
+	constraintColumns := map[string]map[string][]string{
+		"public.users": {
+			"users_email_key": {"email"},
+		},
+	}
+
+	type testCase struct {
+		err     error
+		wrapped bool
+	}
+	cases := []testCase{
+		{
+			err: &pgconn.PgError{
+				Code:           "23505",
+				SchemaName:     "public",
+				TableName:      "users",
+				ConstraintName: "users_email_key",
+			},
+			wrapped: true,
+		},
+		{
+			err: &causedErr{cause: &pq.Error{
+				Code:       "23505",
+				Schema:     "public",
+				Table:      "users",
+				Constraint: "users_email_key",
+			}},
+			wrapped: true,
+		},
+		{
+			// unknown constraint
+			err: &pgconn.PgError{
+				Code:           "23505",
+				SchemaName:     "public",
+				TableName:      "users",
+				ConstraintName: "users_name_key",
+			},
+			wrapped: false,
+		},
+		{
+			// right constraint name, wrong table
+			err: &pgconn.PgError{
+				Code:           "23505",
+				SchemaName:     "other",
+				TableName:      "users",
+				ConstraintName: "users_email_key",
+			},
+			wrapped: false,
+		},
+		{
+			err:     fmt.Errorf("not a postgres error"),
+			wrapped: false,
+		},
+	}
+
+	for i, c := range cases {
+		err := WrapConstraintViolation(c.err, constraintColumns)
+		violation, is := AsConstraintViolation(err)
+		if is != c.wrapped {
+			t.Fatalf("case %d: expected wrapped = %t, got %t", i, c.wrapped, is)
+		}
+		if !is {
+			if err != c.err {
+				t.Fatalf("case %d: expected the error to be returned unchanged", i)
+			}
+			continue
+		}
+
+		if violation.Table != "users" ||
+			violation.Constraint != "users_email_key" ||
+			len(violation.Columns) != 1 || violation.Columns[0] != "email" {
+			t.Fatalf("case %d: unexpected violation: %#v", i, violation)
+		}
+		if !IsUniqueViolation(err) {
+			t.Fatalf("case %d: expected the wrapped error to still be a unique violation", i)
+		}
+
+		// wrapping is idempotent
+		if WrapConstraintViolation(err, constraintColumns) != err {
+			t.Fatalf("case %d: expected wrapping twice to be a no-op", i)
+		}
+	}
+
+	if WrapConstraintViolation(nil, constraintColumns) != nil {
+		t.Fatal("expected nil to stay nil")
+	}
+}
+
 // we define this manually rather than using %w to maintain our msgv
 type causedErr struct {
 	cause error
@@ -61,6 +61,9 @@ type Generator struct {
 	disabledByEnableVar bool
 	// Used to map postgres types to information we can use to codegen go types
 	typeResolver *types.Resolver
+	// The names of the row types generated for statements with a RETURNING
+	// clause. Filled in by genStmts.
+	stmtScanStructNames []string
 }
 
 func FromConfig(config Config) (*Generator, error) {
@@ -165,7 +168,7 @@ func (g *Generator) Gen() error {
 		return err
 	}
 
-	err = g.genPrelude()
+	err = g.genPrelude(conf)
 	if err != nil {
 		return err
 	}
@@ -176,11 +179,6 @@ func (g *Generator) Gen() error {
 
 	var body strings.Builder
 
-	err = g.genPGClient(&body, conf)
-	if err != nil {
-		return err
-	}
-
 	// Tables must be generated first to ensure that the type for a table is generated
 	// by genTables rather than synthesized from a query result.
 	err = g.genTables(&body, conf.Tables)
@@ -188,7 +186,7 @@ func (g *Generator) Gen() error {
 		return err
 	}
 
-	err = g.genQueries(&body, conf.Queries, conf.RequireQueryComments)
+	err = g.genQueries(&body, conf.Queries, conf.RequireQueryComments, conf.Backend == config.BackendPgx)
 	if err != nil {
 		return err
 	}
@@ -198,11 +196,24 @@ func (g *Generator) Gen() error {
 		return err
 	}
 
+	err = g.genChannels(&body, conf)
+	if err != nil {
+		return err
+	}
+
 	err = g.genInterfaces(&body, conf)
 	if err != nil {
 		return err
 	}
 
+	// The client is generated last because it needs to know which statements
+	// return rows, but it goes at the top of the file.
+	var client strings.Builder
+	err = g.genPGClient(&client, conf)
+	if err != nil {
+		return err
+	}
+
 	//
 	// Write the generated code to the file
 	//
@@ -240,6 +251,10 @@ import (
 		return err
 	}
 
+	_, err = out.WriteString(client.String())
+	if err != nil {
+		return err
+	}
 	_, err = out.WriteString(body.String())
 	if err != nil {
 		return err
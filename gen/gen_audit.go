@@ -0,0 +1,307 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/opendoor/pggen/gen/internal/meta"
+	"github.com/opendoor/pggen/gen/internal/names"
+	"github.com/opendoor/pggen/gen/internal/utils"
+)
+
+// genAudit generates the history tracking for a table configured with `audit = true`.
+// The SQL to create the history table and the trigger which fills it gets written to
+// its own file for the user to copy into their migrations, while the `History` method
+// used to read it back gets written to `into`.
+func (g *Generator) genAudit(into io.Writer, genCtx *meta.TableGenCtx) error {
+	g.imports[`"time"`] = true
+
+	info := &genCtx.Meta.Info
+	auditCtx := newAuditGenCtx(genCtx)
+
+	var migration strings.Builder
+	err := auditMigrationTmpl.Execute(&migration, auditCtx)
+	if err != nil {
+		return err
+	}
+	migrationFileName := info.PgRelName + "_history.sql"
+	if info.PgSchema != "public" {
+		migrationFileName = info.PgSchema + "." + migrationFileName
+	}
+	migrationPath := filepath.Join(filepath.Dir(g.config.OutputFileName), migrationFileName)
+	err = writeSQLFile(migrationPath, migration.String())
+	if err != nil {
+		return fmt.Errorf("writing history migration: %s", err.Error())
+	}
+
+	return auditHistoryTmpl.Execute(into, auditCtx)
+}
+
+func newAuditGenCtx(genCtx *meta.TableGenCtx) auditGenCtx {
+	info := &genCtx.Meta.Info
+
+	cols := make([]auditCol, 0, len(info.Cols))
+	for _, col := range info.Cols {
+		auditCol := auditCol{ColMeta: col}
+		// the nullable version of an array type is an array of pointers
+		if strings.HasPrefix(col.TypeInfo.NullName, "[]") {
+			auditCol.ArrayElemName = strings.TrimPrefix(col.TypeInfo.Name, "[]")
+		}
+		cols = append(cols, auditCol)
+	}
+
+	return auditGenCtx{
+		TableGenCtx: genCtx,
+		HistoryPgName: (&names.PgName{
+			Schema: info.PgSchema,
+			Name:   info.PgRelName + "_history",
+		}).String(),
+		TriggerPgName: (&names.PgName{
+			Schema: info.PgSchema,
+			Name:   info.PgRelName + "_history_trigger",
+		}).String(),
+		// indexes and triggers always live in the schema of their table, so they
+		// can't be qualified with a schema name
+		IndexPgName: (&names.PgName{Name: info.PgRelName + "_history_record_id_idx"}).String(),
+		TriggerUnqualifiedPgName: (&names.PgName{
+			Name: info.PgRelName + "_history_trigger",
+		}).String(),
+		Cols: cols,
+	}
+}
+
+func writeSQLFile(path string, src string) error {
+	outFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	return utils.WriteCompletely(outFile, []byte(src))
+}
+
+type auditGenCtx struct {
+	*meta.TableGenCtx
+	// The quoted name of the table that the history is kept in
+	HistoryPgName string
+	// The quoted name of the trigger function which records the history
+	TriggerPgName string
+	// The quoted names of the index on the history table and the trigger,
+	// without a schema
+	IndexPgName              string
+	TriggerUnqualifiedPgName string
+	// The columns of the table
+	Cols []auditCol
+}
+
+type auditCol struct {
+	meta.ColMeta
+	// The go type of the elements of the column if it holds an array, otherwise empty
+	ArrayElemName string
+}
+
+var auditMigrationTmpl *template.Template = template.Must(template.New("audit-migration-tmpl").Parse(`-- Code generated by pggen. DO NOT EDIT.
+--
+-- This migration creates the table which keeps the history of the {{ .PgName }} table,
+-- along with the trigger which fills it. Copy it into your migrations to start
+-- recording the history.
+
+CREATE TABLE IF NOT EXISTS {{ .HistoryPgName }} (
+    history_id bigserial PRIMARY KEY,
+    record_id {{ .PkeyCol.PgType }} NOT NULL,
+    op text NOT NULL,
+    before jsonb,
+    after jsonb,
+    actor text,
+    changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS {{ .IndexPgName }}
+    ON {{ .HistoryPgName }} (record_id, history_id);
+
+CREATE OR REPLACE FUNCTION {{ .TriggerPgName }}() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO {{ .HistoryPgName }} (record_id, op, before, after, actor)
+        VALUES (
+            NEW."{{ .PkeyCol.PgName }}",
+            'insert',
+            NULL,
+            to_jsonb(NEW),
+            NULLIF(current_setting('pggen.audit_actor', true), '')
+        );
+        RETURN NEW;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO {{ .HistoryPgName }} (record_id, op, before, after, actor)
+        VALUES (
+            NEW."{{ .PkeyCol.PgName }}",
+            'update',
+            to_jsonb(OLD),
+            to_jsonb(NEW),
+            NULLIF(current_setting('pggen.audit_actor', true), '')
+        );
+        RETURN NEW;
+    ELSE
+        INSERT INTO {{ .HistoryPgName }} (record_id, op, before, after, actor)
+        VALUES (
+            OLD."{{ .PkeyCol.PgName }}",
+            'delete',
+            to_jsonb(OLD),
+            NULL,
+            NULLIF(current_setting('pggen.audit_actor', true), '')
+        );
+        RETURN OLD;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS {{ .TriggerUnqualifiedPgName }} ON {{ .PgName }};
+CREATE TRIGGER {{ .TriggerUnqualifiedPgName }}
+    AFTER INSERT OR UPDATE OR DELETE ON {{ .PgName }}
+    FOR EACH ROW EXECUTE PROCEDURE {{ .TriggerPgName }}();
+`))
+
+var auditHistoryTmpl *template.Template = template.Must(template.New("audit-history-tmpl").Parse(`
+// {{ .GoName }}Version is an entry in the history of a {{ .GoName }}, describing
+// a single change to the record.
+type {{ .GoName }}Version struct {
+	// The kind of change. One of pggen.ChangeInsert, pggen.ChangeUpdate or pggen.ChangeDelete.
+	Op pggen.ChangeOp
+	// The record before the change. Nil for inserts.
+	Before *{{ .GoName }}
+	// The record after the change. Nil for deletes.
+	After *{{ .GoName }}
+	// The actor set with middleware.WithActor when the change was made, if there was one
+	Actor *string
+	// The time of the transaction which made the change
+	ChangedAt time.Time
+}
+
+// History{{ .GoName }} returns every recorded version of the {{ .GoName }} with the
+// given id, oldest first.
+func (p *PGClient) History{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) ([]{{ .GoName }}Version, error) {
+	return p.impl.history{{ .GoName }}(ctx, id)
+}
+func (tx *TxPGClient) History{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) ([]{{ .GoName }}Version, error) {
+	return tx.impl.history{{ .GoName }}(ctx, id)
+}
+func (conn *ConnPGClient) History{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) ([]{{ .GoName }}Version, error) {
+	return conn.impl.history{{ .GoName }}(ctx, id)
+}
+func (p *pgClientImpl) history{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) ([]{{ .GoName }}Version, error) {
+	p = p.forRead(ctx)
+
+	// The json snapshots are turned back into rows of {{ .PgName }} so that they can
+	// be read with a single query. Each side falls back to the other so that inserts
+	// and deletes still produce a row, and the flags say which sides really exist.
+	rows, err := p.queryContext(
+		ctx,
+		` + "`" + `SELECT h.op, h.actor, h.changed_at, h.before IS NOT NULL, h.after IS NOT NULL
+		{{- range .Meta.Info.Cols }}, b."{{ .PgName }}"{{ end }}
+		{{- range .Meta.Info.Cols }}, a."{{ .PgName }}"{{ end }}
+		FROM {{ .HistoryPgName }} h
+		CROSS JOIN LATERAL jsonb_populate_record(NULL::{{ .PgName }}, COALESCE(h.before, h.after)) AS b
+		CROSS JOIN LATERAL jsonb_populate_record(NULL::{{ .PgName }}, COALESCE(h.after, h.before)) AS a
+		WHERE h.record_id = $1
+		ORDER BY h.history_id` + "`" + `,
+		{{ call .PkeyCol.TypeInfo.SqlArgument "id" }},
+	)
+	if err != nil {
+		return nil, p.client.errorConverter(err)
+	}
+
+	versions := []{{ .GoName }}Version{}
+	for rows.Next() {
+		var (
+			version {{ .GoName }}Version
+			op string
+			actor sql.NullString
+			hasBefore bool
+			hasAfter bool
+			before historyScanTgtsFor{{ .GoName }}
+			after historyScanTgtsFor{{ .GoName }}
+		)
+		scanTgts := []interface{}{&op, &actor, &version.ChangedAt, &hasBefore, &hasAfter}
+		scanTgts = append(scanTgts, before.scanTgts()...)
+		scanTgts = append(scanTgts, after.scanTgts()...)
+		err = rows.Scan(scanTgts...)
+		if err != nil {
+			_ = rows.Close()
+			return nil, p.client.errorConverter(err)
+		}
+
+		version.Op = pggen.ChangeOp(op)
+		version.Actor = convertNullString(actor)
+		if hasBefore {
+			version.Before = before.record()
+		}
+		if hasAfter {
+			version.After = after.record()
+		}
+		versions = append(versions, version)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, p.client.errorConverter(err)
+	}
+
+	return versions, nil
+}
+
+// historyScanTgtsFor{{ .GoName }} holds nullable scan targets for every column of
+// {{ .GoName }}. Even NOT NULL columns can come back null when reading history,
+// because a column added after a version was recorded is missing from its snapshot.
+type historyScanTgtsFor{{ .GoName }} struct {
+	{{- range .Cols }}
+	scan{{ .GoName }} {{ .TypeInfo.ScanNullName }}
+	{{- end }}
+}
+
+func (tgts *historyScanTgtsFor{{ .GoName }}) scanTgts() []interface{} {
+	return []interface{}{
+		{{- range .Cols }}
+		{{ call .TypeInfo.NullSqlReceiver (printf "tgts.scan%s" .GoName) }},
+		{{- end }}
+	}
+}
+
+// record converts the scanned values into a {{ .GoName }}, leaving missing values
+// of NOT NULL columns as zero values.
+func (tgts *historyScanTgtsFor{{ .GoName }}) record() *{{ .GoName }} {
+	var r {{ .GoName }}
+	{{- range .Cols }}
+	{{- if .Nullable }}
+	r.{{ .GoName }} = {{ call .TypeInfo.NullConvertFunc (printf "tgts.scan%s" .GoName) }}
+	{{- else if .ArrayElemName }}
+	for _, elem := range {{ call .TypeInfo.NullConvertFunc (printf "tgts.scan%s" .GoName) }} {
+		var v {{ .ArrayElemName }}
+		if elem != nil {
+			v = *elem
+		}
+		r.{{ .GoName }} = append(r.{{ .GoName }}, v)
+	}
+	{{- else }}
+	if v := {{ call .TypeInfo.NullConvertFunc (printf "tgts.scan%s" .GoName) }}; v != nil {
+		r.{{ .GoName }} = *v
+	}
+	{{- end }}
+	{{- end }}
+	return &r
+}
+`))
@@ -0,0 +1,39 @@
+package gen
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/opendoor/pggen/gen/internal/meta"
+)
+
+// The test database can't be migrated with the generated history migration
+// because the migration only exists once the models have been generated, so
+// db.sql carries a copy of it which must be kept in sync with the template.
+func TestAuditMigrationMatchesTestDB(t *testing.T) {
+	genCtx := meta.TableGenCtx{
+		PgName:  `"audited_entities"`,
+		PkeyCol: &meta.ColMeta{PgName: "id", PgType: "integer"},
+		Meta: &meta.TableMeta{
+			Info: meta.PgTableInfo{PgSchema: "public", PgRelName: "audited_entities"},
+		},
+	}
+
+	var migration strings.Builder
+	err := auditMigrationTmpl.Execute(&migration, newAuditGenCtx(&genCtx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// skip the header comment
+	body := migration.String()
+	body = body[strings.Index(body, "\n\n")+2:]
+
+	dbSQL, err := ioutil.ReadFile("../cmd/pggen/test/db.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dbSQL), body) {
+		t.Fatalf("cmd/pggen/test/db.sql is out of date. It should contain:\n%s", body)
+	}
+}
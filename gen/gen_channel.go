@@ -0,0 +1,145 @@
+package gen
+
+import (
+	"io"
+	"text/template"
+
+	"github.com/opendoor/pggen/gen/internal/config"
+	"github.com/opendoor/pggen/gen/internal/names"
+)
+
+func (g *Generator) genChannels(into io.Writer, conf *config.DbConfig) error {
+	if len(conf.Channels) > 0 {
+		g.log.Infof("	generating %d channels\n", len(conf.Channels))
+	} else {
+		return nil
+	}
+
+	g.imports[`"context"`] = true
+	g.imports[`"encoding/json"`] = true
+	g.imports[`"fmt"`] = true
+	g.imports[`"github.com/opendoor/pggen"`] = true
+
+	genCtx := channelsGenCtx{
+		Pgx:      conf.Backend == config.BackendPgx,
+		Channels: make([]channelGenCtx, 0, len(conf.Channels)),
+	}
+	for _, cc := range conf.Channels {
+		g.log.Infof("		generating channel '%s'\n", cc.Name)
+
+		if len(cc.Pkg) > 0 {
+			g.imports[cc.Pkg] = true
+		}
+		genCtx.Channels = append(genCtx.Channels, channelGenCtx{
+			PgName:   cc.Name,
+			GoName:   names.PgToGoName(cc.Name),
+			TypeName: cc.TypeName,
+		})
+	}
+
+	return channelsTmpl.Execute(into, genCtx)
+}
+
+type channelsGenCtx struct {
+	// true if the generated code talks to pgx directly rather than database/sql
+	Pgx      bool
+	Channels []channelGenCtx
+}
+
+type channelGenCtx struct {
+	// The name of the channel in postgres
+	PgName string
+	// The name of the channel to use in generated method names
+	GoName string
+	// The type of the payloads sent on the channel
+	TypeName string
+}
+
+var channelsTmpl *template.Template = template.Must(template.New("channels-tmpl").Parse(`
+// listenConnector opens the dedicated connections used by the Listen methods
+func (p *PGClient) listenConnector() pggen.ListenConnector {
+	{{- if .Pgx }}
+	return pggen.PgxListenConnector(p.topLevelDB)
+	{{- else }}
+	return pggen.SQLListenConnector(p.topLevelDB)
+	{{- end }}
+}
+{{ range .Channels }}
+// Notify{{ .GoName }} sends the given payload to everyone listening on the '{{ .PgName }}'
+// channel. Inside a transaction, the notification is only delivered once the
+// transaction commits.
+func (p *PGClient) Notify{{ .GoName }}(ctx context.Context, payload {{ .TypeName }}) error {
+	return p.impl.notify{{ .GoName }}(ctx, payload)
+}
+// Notify{{ .GoName }} sends the given payload to everyone listening on the '{{ .PgName }}'
+// channel. Inside a transaction, the notification is only delivered once the
+// transaction commits.
+func (tx *TxPGClient) Notify{{ .GoName }}(ctx context.Context, payload {{ .TypeName }}) error {
+	return tx.impl.notify{{ .GoName }}(ctx, payload)
+}
+// Notify{{ .GoName }} sends the given payload to everyone listening on the '{{ .PgName }}'
+// channel. Inside a transaction, the notification is only delivered once the
+// transaction commits.
+func (conn *ConnPGClient) Notify{{ .GoName }}(ctx context.Context, payload {{ .TypeName }}) error {
+	return conn.impl.notify{{ .GoName }}(ctx, payload)
+}
+func (p *pgClientImpl) notify{{ .GoName }}(ctx context.Context, payload {{ .TypeName }}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+
+	_, err = p.db.ExecContext(
+		ctx,
+		"SELECT pg_notify($1, $2)",
+		` + "`" + `{{ .PgName }}` + "`" + `,
+		string(data),
+	)
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+	return nil
+}
+
+// Listen{{ .GoName }} listens for payloads sent on the '{{ .PgName }}' channel using
+// a connection dedicated to the purpose. If the connection fails, a new one is opened
+// in its place. Payloads sent while there is no connection are lost, as are payloads
+// which fail to decode. The returned channel is closed once 'ctx' is done.
+func (p *PGClient) Listen{{ .GoName }}(
+	ctx context.Context,
+	opts ...pggen.ListenOpt,
+) (<-chan {{ .TypeName }}, error) {
+	var listenOpts pggen.ListenOptions
+	for _, opt := range opts {
+		opt(&listenOpts)
+	}
+
+	payloads, err := pggen.Listen(ctx, p.listenConnector(), ` + "`" + `{{ .PgName }}` + "`" + `, opts...)
+	if err != nil {
+		return nil, p.errorConverter(err)
+	}
+
+	values := make(chan {{ .TypeName }})
+	go func() {
+		defer close(values)
+
+		for payload := range payloads {
+			var value {{ .TypeName }}
+			err := json.Unmarshal([]byte(payload), &value)
+			if err != nil {
+				listenOpts.ReportError(fmt.Errorf("decoding '{{ .PgName }}' payload: %s", err.Error()))
+				continue
+			}
+
+			select {
+			case values <- value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return values, nil
+}
+{{ end }}
+`))
@@ -7,6 +7,7 @@ import (
 
 	"github.com/opendoor/pggen/gen/internal/config"
 	"github.com/opendoor/pggen/gen/internal/meta"
+	"github.com/opendoor/pggen/gen/internal/names"
 )
 
 // genInterfaces emits the DBQueries interface shared between the generated PGClient
@@ -25,9 +26,11 @@ func (g *Generator) genInterfaces(into io.Writer, conf *config.DbConfig) error {
 		}
 
 		genCtx.Tables = append(genCtx.Tables, tableIfaceGenCtx{
-			GoName:     tableInfo.Info.GoName,
-			PkeyType:   tableInfo.Info.PkeyCol.TypeInfo.Name,
-			BoxResults: tableInfo.Config.BoxResults,
+			GoName:       tableInfo.Info.GoName,
+			PkeyType:     tableInfo.Info.PkeyCol.TypeInfo.Name,
+			BoxResults:   tableInfo.Config.BoxResults,
+			HasDeletedAt: tableInfo.HasDeletedAtField,
+			Audit:        tableInfo.Config.Audit,
 		})
 	}
 
@@ -51,6 +54,16 @@ func (g *Generator) genInterfaces(into io.Writer, conf *config.DbConfig) error {
 		genCtx.Stmts = append(genCtx.Stmts, meta)
 	}
 
+	// populate channels
+	genCtx.Channels = make([]channelGenCtx, 0, len(conf.Channels))
+	for _, cc := range conf.Channels {
+		genCtx.Channels = append(genCtx.Channels, channelGenCtx{
+			PgName:   cc.Name,
+			GoName:   names.PgToGoName(cc.Name),
+			TypeName: cc.TypeName,
+		})
+	}
+
 	return dbQueriesTmpl.Execute(into, genCtx)
 }
 
@@ -58,6 +71,10 @@ type tableIfaceGenCtx struct {
 	GoName     string
 	PkeyType   string
 	BoxResults bool
+	// true if the table supports soft deletes
+	HasDeletedAt bool
+	// true if the history of the table is recorded
+	Audit bool
 }
 
 type ifaceGenCtx struct {
@@ -65,11 +82,15 @@ type ifaceGenCtx struct {
 	Queries     []meta.QueryMeta
 	StoredFuncs []meta.QueryMeta
 	Stmts       []meta.StmtMeta
+	Channels    []channelGenCtx
 }
 
 var dbQueriesTmpl *template.Template = template.Must(template.New("db-queries-tmpl").Parse(`
 
 type DBQueries interface {
+	// run a routine in a transaction, or in a savepoint if already inside one
+	WithTx(ctx context.Context, opts *pggen.TxOptions, fn func(tx *TxPGClient) error) error
+
 	//
 	// automatic CRUD methods
 	//
@@ -78,13 +99,23 @@ type DBQueries interface {
 	// {{ .GoName }} methods
 	Get{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}, opts ...pggen.GetOpt) (*{{ .GoName }}, error)
 	List{{ .GoName }}(ctx context.Context, ids []{{ .PkeyType }}, opts ...pggen.ListOpt) ([]{{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
+	List{{ .GoName }}Map(ctx context.Context, ids []{{ .PkeyType }}, opts ...pggen.ListOpt) (map[{{ .PkeyType }}]*{{ .GoName }}, error)
 	Insert{{ .GoName }}(ctx context.Context, value *{{ .GoName }}, opts ...pggen.InsertOpt) ({{ .PkeyType }}, error)
 	BulkInsert{{ .GoName }}(ctx context.Context, values []{{ .GoName }}, opts ...pggen.InsertOpt) ([]{{ .PkeyType }}, error)
+	Insert{{ .GoName }}Graph(ctx context.Context, value *{{ .GoName }}, includes *include.Spec, opts ...pggen.InsertOpt) ({{ .PkeyType }}, error)
 	Update{{ .GoName }}(ctx context.Context, value *{{ .GoName }}, fieldMask pggen.FieldSet, opts ...pggen.UpdateOpt) (ret {{ .PkeyType }}, err error)
 	Upsert{{ .GoName }}(ctx context.Context, value *{{ .GoName }}, constraintNames []string, fieldMask pggen.FieldSet, opts ...pggen.UpsertOpt) ({{ .PkeyType }}, error)
 	BulkUpsert{{ .GoName }}(ctx context.Context, values []{{ .GoName }}, constraintNames []string, fieldMask pggen.FieldSet, opts ...pggen.UpsertOpt) ([]{{ .PkeyType }}, error)
 	Delete{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}, opts ...pggen.DeleteOpt) error
 	BulkDelete{{ .GoName }}(ctx context.Context, ids []{{ .PkeyType }}, opts ...pggen.DeleteOpt) error
+	{{- if .HasDeletedAt }}
+	Restore{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}) error
+	BulkRestore{{ .GoName }}(ctx context.Context, ids []{{ .PkeyType }}) error
+	PurgeDeleted{{ .GoName }}(ctx context.Context, olderThan time.Time) (int64, error)
+	{{- end }}
+	{{- if .Audit }}
+	History{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}) ([]{{ .GoName }}Version, error)
+	{{- end }}
 	{{ .GoName }}FillIncludes(ctx context.Context, rec *{{ .GoName }}, includes *include.Spec, opts ...pggen.IncludeOpt) error
 	{{ .GoName }}BulkFillIncludes(ctx context.Context, recs []*{{ .GoName }}, includes *include.Spec, opts ...pggen.IncludeOpt) error
 	{{ end }}
@@ -98,13 +129,17 @@ type DBQueries interface {
 	// {{ .ConfigData.Name }} query
 	{{ .ConfigData.Name }}(
 		ctx context.Context,
+		{{- if .ConfigData.ArgsStruct }}
+		params {{ .ConfigData.Name }}Params,
+		{{- else }}
 		{{- range .Args }}
-		{{- if $query.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ .GoName }} {{ .TypeInfo.NullName }},
 		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
 		{{- end }}
 		{{- end }}
+		{{- end }}
 	{{- if (not .MultiReturn) }}
 	) ({{ .ReturnTypeName }}, error)
 	{{- else }}
@@ -115,20 +150,32 @@ type DBQueries interface {
 	// {{ .ConfigData.Name }} query
 	{{ .ConfigData.Name }}(
 		ctx context.Context,
+		{{- if .ConfigData.ArgsStruct }}
+		params {{ .ConfigData.Name }}Params,
+		{{- else }}
 		{{- range .Args }}
-		{{- if $query.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ .GoName }} {{ .TypeInfo.NullName }},
 		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
 		{{- end }}
 		{{- end }}
+		{{- end }}
 	) ([]{{- if .ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, error)
 	{{ .ConfigData.Name }}Query(
 		ctx context.Context,
+		{{- if .ConfigData.ArgsStruct }}
+		params {{ .ConfigData.Name }}Params,
+		{{- else }}
 		{{- range .Args }}
+		{{- if .Nullable }}
+		{{ .GoName }} {{ .TypeInfo.NullName }},
+		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
 		{{- end }}
-	) (*sql.Rows, error)
+		{{- end }}
+		{{- end }}
+	) (PGRows, error)
 	{{ end }}
 	{{ end }}
 
@@ -149,7 +196,7 @@ type DBQueries interface {
 		{{- range .Args }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
 		{{- end }}
-	) (*sql.Rows, error)
+	) (PGRows, error)
 	{{ end }}
 
 	//
@@ -160,10 +207,31 @@ type DBQueries interface {
 	// {{ .ConfigData.Name }} stmt
 	{{ .ConfigData.Name }}(
 		ctx context.Context,
+		{{- if .ConfigData.ArgsStruct }}
+		params {{ .ConfigData.Name }}Params,
+		{{- else }}
 		{{- range .Args}}
+		{{- if .Nullable }}
+		{{ .GoName }} {{ .TypeInfo.NullName }},
+		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
+		{{- end }}
 		{{- end}}
+		{{- end }}
+	{{- if .Returning }}
+	) ({{ if .ConfigData.SingleResult }}{{ if .MultiReturn }}*{{ end }}{{ else }}[]{{ end }}{{ .ReturnTypeName }}, int64, error)
+	{{- else }}
 	) (sql.Result, error)
+	{{- end }}
+	{{ end }}
+
+	//
+	// channel methods
+	//
+
+	{{ range .Channels }}
+	// {{ .PgName }} channel
+	Notify{{ .GoName }}(ctx context.Context, payload {{ .TypeName }}) error
 	{{ end }}
 }
 
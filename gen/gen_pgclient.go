@@ -10,11 +10,25 @@ import (
 
 func (g *Generator) genPGClient(into io.Writer, conf *config.DbConfig) error {
 	g.imports[`"github.com/opendoor/pggen"`] = true
+	g.imports[`"context"`] = true
 	g.imports[`"database/sql"`] = true
+	g.imports[`"fmt"`] = true
 	g.imports[`"sync"`] = true
+	g.imports[`"sync/atomic"`] = true
+	if conf.Backend == config.BackendPgx {
+		g.imports[`"github.com/jackc/pgx/v4"`] = true
+	}
 
 	type genCtx struct {
 		ScanStructNames []string
+		// true if any tables are configured, in which case a table of their
+		// constraints gets generated
+		HasTables bool
+		// true if the generated code talks to pgx directly rather than database/sql
+		Pgx bool
+		// the types of the database connections that the client accepts and exposes
+		ConnType   string
+		HandleType string
 	}
 
 	scanStructNames := make([]string, 0, len(conf.Tables))
@@ -24,8 +38,29 @@ func (g *Generator) genPGClient(into io.Writer, conf *config.DbConfig) error {
 	for _, qc := range conf.Queries {
 		scanStructNames = append(scanStructNames, names.PgToGoName(qc.Name)+"Row")
 	}
+	// statements may share a return type with a table or query
+	seen := make(map[string]bool, len(scanStructNames))
+	for _, name := range scanStructNames {
+		seen[name] = true
+	}
+	for _, name := range g.stmtScanStructNames {
+		if !seen[name] {
+			seen[name] = true
+			scanStructNames = append(scanStructNames, name)
+		}
+	}
 
-	gCtx := genCtx{ScanStructNames: scanStructNames}
+	gCtx := genCtx{
+		ScanStructNames: scanStructNames,
+		HasTables:       len(conf.Tables) > 0,
+		Pgx:             conf.Backend == config.BackendPgx,
+		ConnType:        "pggen.DBConn",
+		HandleType:      "pggen.DBHandle",
+	}
+	if gCtx.Pgx {
+		gCtx.ConnType = "pggen.PgxConn"
+		gCtx.HandleType = "pggen.PgxHandle"
+	}
 
 	return pgClientTmpl.Execute(into, &gCtx)
 }
@@ -36,7 +71,12 @@ var pgClientTmpl *template.Template = template.Must(template.New("pgclient-tmpl"
 // database access methods for this package are attached to it.
 type PGClient struct {
 	impl pgClientImpl
-	topLevelDB pggen.DBConn
+	topLevelDB {{ .ConnType }}
+
+	// read replicas to send reads to, along with a counter used to spread the
+	// reads between them
+	replicas []{{ .ConnType }}
+	nextReplica uint32
 
 	errorConverter func(error) error
 
@@ -54,24 +94,37 @@ type PGClient struct {
 // bogus usage so we can compile with no tables configured
 var _ = sync.RWMutex{}
 
+{{- if .Pgx }}
+
+// NewPGClient creates a new PGClient out of a pgx connection pool or
+// connection, such as a '*pgxpool.Pool' or a '*pgxpool.Conn'.
+{{- else }}
+
 // NewPGClient creates a new PGClient out of a '*sql.DB' or a
 // custom wrapper around a db connection.
 //
 // If you provide your own wrapper around a '*sql.DB' for logging or
 // custom tracing, you MUST forward all calls to an underlying '*sql.DB'
 // member of your wrapper.
+{{- end }}
 //
-// If the DBConn passed into NewPGClient implements an ErrorConverter
+// If the connection passed into NewPGClient implements an ErrorConverter
 // method which returns a func(error) error, the result of calling the
 // ErrorConverter method will be called on every error that the generated
 // code returns right before the error is returned. If ErrorConverter
 // returns nil or is not present, it will default to the identity function.
-func NewPGClient(conn pggen.DBConn) *PGClient {
+// Violations of constraints on the configured tables are wrapped in a
+// *pggen.ConstraintViolationError before being passed to the ErrorConverter.
+func NewPGClient(conn {{ .ConnType }}) *PGClient {
 	client := PGClient {
 		topLevelDB: conn,
 	}
 	client.impl = pgClientImpl{
+		{{- if .Pgx }}
+		db: pgxDB{handle: conn},
+		{{- else }}
 		db: conn,
+		{{- end }}
 		client: &client,
 	}
 
@@ -85,16 +138,37 @@ func NewPGClient(conn pggen.DBConn) *PGClient {
 	if client.errorConverter == nil {
 		client.errorConverter = func(err error) error { return err }
 	}
+	{{- if .HasTables }}
+	userErrorConverter := client.errorConverter
+	client.errorConverter = func(err error) error {
+		return userErrorConverter(pggen.WrapConstraintViolation(err, tableConstraints))
+	}
+	{{- end }}
 
 	return &client
 }
 
-func (p *PGClient) Handle() pggen.DBHandle {
+// NewPGClientWithReplicas creates a new PGClient which sends reads to the given
+// read replicas and everything else to the primary. The Get, List and FillIncludes
+// methods and queries configured with 'read_only = true' count as reads when they
+// are called directly on the PGClient. Reads made through a TxPGClient or ConnPGClient
+// always go to the connection that they are bound to, as do reads made with a context
+// returned by pggen.UsePrimary, which is useful when a read must see a write that
+// has just been made. Reads are spread between the replicas round-robin.
+//
+// The ErrorConverter of the primary is used for errors from the replicas as well.
+func NewPGClientWithReplicas(primary {{ .ConnType }}, replicas ...{{ .ConnType }}) *PGClient {
+	client := NewPGClient(primary)
+	client.replicas = replicas
+	return client
+}
+
+func (p *PGClient) Handle() {{ .HandleType }} {
 	return p.topLevelDB
 }
 
 func (p *PGClient) BeginTx(ctx context.Context, opts *sql.TxOptions) (*TxPGClient, error) {
-	tx, err := p.topLevelDB.BeginTx(ctx, opts)
+	tx, err := beginTx(ctx, p.impl.db, opts)
 	if err != nil {
 		return nil, p.errorConverter(err)
 	}
@@ -103,10 +177,69 @@ func (p *PGClient) BeginTx(ctx context.Context, opts *sql.TxOptions) (*TxPGClien
 		impl: pgClientImpl{
 			db: tx,
 			client: p,
+			hooks: &txHooks{},
 		},
 	}, nil
 }
 
+// WithTx runs 'fn' in a transaction, committing if it returns nil and rolling back
+// if it returns an error or panics. If the transaction fails because of a serialization
+// failure or a deadlock, the whole thing is retried after a backoff, up to the limit
+// given in 'opts'. This means that 'fn' may be called more than once, so it should not
+// have side effects outside of the transaction. Errors are classified by looking
+// through their Unwrap chains, so error converters which discard the original error
+// will prevent retries.
+func (p *PGClient) WithTx(
+	ctx context.Context,
+	opts *pggen.TxOptions,
+	fn func(tx *TxPGClient) error,
+) error {
+	var txOpts *sql.TxOptions
+	if opts != nil {
+		txOpts = &opts.TxOptions
+	}
+
+	return retryTx(ctx, opts, func() error {
+		return runTx(p.errorConverter, func() (*TxPGClient, error) {
+			return p.BeginTx(ctx, txOpts)
+		}, fn)
+	})
+}
+
+// runTx makes a single attempt at running 'fn' in a transaction
+func runTx(
+	errorConverter func(error) error,
+	begin func() (*TxPGClient, error),
+	fn func(tx *TxPGClient) error,
+) error {
+	tx, err := begin()
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			// we are either returning an error or unwinding from a panic
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	// even a failed commit ends the transaction
+	committed = true
+	if err != nil {
+		return errorConverter(err)
+	}
+	return nil
+}
+
+{{- if not .Pgx }}
 func (p *PGClient) Conn(ctx context.Context) (*ConnPGClient, error) {
 	conn, err := p.topLevelDB.Conn(ctx)
 	if err != nil {
@@ -115,42 +248,301 @@ func (p *PGClient) Conn(ctx context.Context) (*ConnPGClient, error) {
 
 	return &ConnPGClient{impl: pgClientImpl{ db: conn, client: p }}, nil
 }
+{{- end }}
 
 // A postgres client that operates within a transaction. Supports all the same
 // generated methods that PGClient does.
 type TxPGClient struct {
 	impl pgClientImpl
+
+	// the name of the savepoint that this client operates within, or the empty
+	// string if it operates within the transaction as a whole.
+	savepoint string
+	// how many savepoints deep this client is
+	depth int
+	// the hooks which were already registered when the savepoint was established
+	hooksMark txHooksMark
 }
 
-func (tx *TxPGClient) Handle() pggen.DBHandle {
+func (tx *TxPGClient) Handle() {{ .HandleType }} {
+	{{- if .Pgx }}
+	return tx.impl.db.handle
+	{{- else }}
 	return tx.impl.db.(*sql.Tx)
+	{{- end }}
 }
 
+// Rollback rolls back the whole transaction. It is an error to call it on a client
+// returned by Savepoint, use RollbackTo instead.
 func (tx *TxPGClient) Rollback() error {
-	return tx.impl.db.(*sql.Tx).Rollback()
+	if tx.savepoint != "" {
+		return tx.impl.client.errorConverter(fmt.Errorf(
+			"Rollback: called within savepoint '%s', use RollbackTo instead", tx.savepoint))
+	}
+
+	err := rollbackTx(tx.impl.db)
+	if err != nil {
+		return err
+	}
+	tx.impl.hooks.finish(false)
+	return nil
 }
 
+// Commit commits the whole transaction. It is an error to call it on a client
+// returned by Savepoint, use Release instead.
 func (tx *TxPGClient) Commit() error {
-	return tx.impl.db.(*sql.Tx).Commit()
+	if tx.savepoint != "" {
+		return tx.impl.client.errorConverter(fmt.Errorf(
+			"Commit: called within savepoint '%s', use Release instead", tx.savepoint))
+	}
+
+	err := commitTx(tx.impl.db)
+	if err != nil {
+		if err != errTxDone {
+			// a failed commit still ends the transaction
+			tx.impl.hooks.finish(false)
+		}
+		return err
+	}
+	tx.impl.hooks.finish(true)
+	return nil
+}
+
+// OnCommit registers 'fn' to be run once the transaction commits. Hooks run in the
+// order that they were registered, after the commit has succeeded. Hooks registered
+// through a savepoint client are dropped if the savepoint is rolled back to.
+func (tx *TxPGClient) OnCommit(fn func()) {
+	tx.impl.hooks.addOnCommit(fn)
+}
+
+// OnRollback registers 'fn' to be run if the transaction gets rolled back. Hooks
+// registered through a savepoint client also run if the savepoint is rolled back to.
+func (tx *TxPGClient) OnRollback(fn func()) {
+	tx.impl.hooks.addOnRollback(fn)
+}
+
+// Savepoint establishes a new savepoint with the given name within the transaction
+// and returns a client which operates within it. The returned client supports all
+// the same generated methods, and its Release and RollbackTo methods can be used to
+// keep or discard the changes made since the savepoint was established.
+func (tx *TxPGClient) Savepoint(ctx context.Context, name string) (*TxPGClient, error) {
+	_, err := tx.impl.db.ExecContext(ctx, "SAVEPOINT "+quoteIdent(name))
+	if err != nil {
+		return nil, tx.impl.client.errorConverter(err)
+	}
+
+	return &TxPGClient{
+		impl:      tx.impl,
+		savepoint: name,
+		depth:     tx.depth + 1,
+		hooksMark: tx.impl.hooks.mark(),
+	}, nil
 }
 
+// Release releases the savepoint that this client was created for, keeping
+// the changes made since it was established as part of the enclosing transaction.
+func (tx *TxPGClient) Release(ctx context.Context) error {
+	if tx.savepoint == "" {
+		return tx.impl.client.errorConverter(fmt.Errorf("Release: not called within a savepoint"))
+	}
+
+	_, err := tx.impl.db.ExecContext(ctx, "RELEASE SAVEPOINT "+quoteIdent(tx.savepoint))
+	if err != nil {
+		return tx.impl.client.errorConverter(err)
+	}
+	return nil
+}
+
+// RollbackTo discards all the changes made since the savepoint that this client
+// was created for was established. The savepoint remains established, so the client
+// may continue to be used afterwards. RollbackTo also recovers a transaction which
+// has been aborted by an error since the savepoint was established.
+func (tx *TxPGClient) RollbackTo(ctx context.Context) error {
+	if tx.savepoint == "" {
+		return tx.impl.client.errorConverter(fmt.Errorf("RollbackTo: not called within a savepoint"))
+	}
+
+	_, err := tx.impl.db.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+quoteIdent(tx.savepoint))
+	if err != nil {
+		return tx.impl.client.errorConverter(err)
+	}
+	tx.impl.hooks.rollbackTo(tx.hooksMark)
+	return nil
+}
+
+// WithTx runs 'fn' within a new savepoint, releasing it if 'fn' returns nil and
+// rolling back to it if 'fn' returns an error or panics. This allows code which
+// wants its own transaction to compose with callers that are already inside one.
+//
+// 'opts' is ignored. The isolation level is fixed by the enclosing transaction, and
+// serialization failures can only be fixed by retrying the whole transaction, so
+// they are passed along for the enclosing WithTx to retry.
+func (tx *TxPGClient) WithTx(
+	ctx context.Context,
+	opts *pggen.TxOptions,
+	fn func(tx *TxPGClient) error,
+) error {
+	sp, err := tx.Savepoint(ctx, fmt.Sprintf("pggen_savepoint_%d", tx.depth+1))
+	if err != nil {
+		return err
+	}
+
+	released := false
+	defer func() {
+		if !released {
+			// we are either returning an error or unwinding from a panic
+			_ = sp.RollbackTo(ctx)
+			_ = sp.Release(ctx)
+		}
+	}()
+
+	err = fn(sp)
+	if err != nil {
+		return err
+	}
+
+	err = sp.Release(ctx)
+	// if the release failed, there is nothing left to roll back to
+	released = true
+	return err
+}
+
+{{- if .Pgx }}
+// A postgres client that operates on a single connection. Code generated for pgx has
+// no need for it because a connection acquired from a pgx pool can be passed directly
+// to NewPGClient, but it is kept around so that code generated for database/sql and
+// pgx has the same shape.
+{{- end }}
 type ConnPGClient struct {
 	impl pgClientImpl
 }
 
+// WithTx works just like PGClient.WithTx, except that the transaction runs on
+// this client's connection.
+func (conn *ConnPGClient) WithTx(
+	ctx context.Context,
+	opts *pggen.TxOptions,
+	fn func(tx *TxPGClient) error,
+) error {
+	var txOpts *sql.TxOptions
+	if opts != nil {
+		txOpts = &opts.TxOptions
+	}
+
+	errorConverter := conn.impl.client.errorConverter
+	return retryTx(ctx, opts, func() error {
+		return runTx(errorConverter, func() (*TxPGClient, error) {
+			tx, err := beginTx(ctx, conn.impl.db, txOpts)
+			if err != nil {
+				return nil, errorConverter(err)
+			}
+			return &TxPGClient{
+				impl: pgClientImpl{db: tx, client: conn.impl.client, hooks: &txHooks{}},
+			}, nil
+		}, fn)
+	})
+}
+
+{{- if not .Pgx }}
 func (conn *ConnPGClient) Close() error {
 	return conn.impl.db.(*sql.Conn).Close()
 }
+{{- end }}
 
-func (conn *ConnPGClient) Handle() pggen.DBHandle {
+func (conn *ConnPGClient) Handle() {{ .HandleType }} {
+	{{- if .Pgx }}
+	return conn.impl.db.handle
+	{{- else }}
 	return conn.impl.db
+	{{- end }}
 }
 
 // A database client that can wrap either a direct database connection or a transaction
 type pgClientImpl struct {
-	db pggen.DBHandle
+	db dbHandle
 	// a reference back to the owning PGClient so we can always get at the resolver tables
 	client *PGClient
+	// the commit and rollback hooks of the transaction that 'db' belongs to, or nil
+	// if 'db' is not a transaction
+	hooks *txHooks
 }
 
+// forRead returns the client impl that a read should be made with, which is one
+// of the read replicas if this is the top level impl of a PGClient with replicas.
+func (p *pgClientImpl) forRead(ctx context.Context) *pgClientImpl {
+	replicas := p.client.replicas
+	if len(replicas) == 0 || p != &p.client.impl || pggen.UsesPrimary(ctx) {
+		return p
+	}
+
+	n := atomic.AddUint32(&p.client.nextReplica, 1)
+	return &pgClientImpl{
+		{{- if .Pgx }}
+		db: pgxDB{handle: replicas[n%uint32(len(replicas))]},
+		{{- else }}
+		db: replicas[n%uint32(len(replicas))],
+		{{- end }}
+		client: p.client,
+	}
+}
+
+
+{{- if .Pgx }}
+
+// PGBatch collects queries to be sent to the database in a single round trip.
+// Each query gets queued with the Queue method generated for it, which returns
+// a future that holds the result of the query once the batch has been sent.
+type PGBatch struct {
+	impl *pgClientImpl
+	batch pgx.Batch
+	// routines to read the results of the queued queries, in the order that
+	// they were queued
+	readers []func(ctx context.Context, results pgx.BatchResults) error
+	sent bool
+}
+
+// Batch returns a new, empty batch of queries which will be run by this client
+func (p *PGClient) Batch() *PGBatch {
+	return &PGBatch{impl: &p.impl}
+}
+
+// Batch returns a new, empty batch of queries which will be run within the transaction
+func (tx *TxPGClient) Batch() *PGBatch {
+	return &PGBatch{impl: &tx.impl}
+}
+
+// Batch returns a new, empty batch of queries which will be run on the connection
+func (conn *ConnPGClient) Batch() *PGBatch {
+	return &PGBatch{impl: &conn.impl}
+}
+
+// Send sends all the queued queries to the database in a single round trip and
+// fills in their futures. It returns the first error encountered by any of the
+// queries. Once a query fails, the queries queued after it fail as well, so the
+// futures of every query should still be checked. A batch may only be sent once.
+func (b *PGBatch) Send(ctx context.Context) error {
+	if b.sent {
+		return b.impl.client.errorConverter(fmt.Errorf("PGBatch.Send: the batch has already been sent"))
+	}
+	b.sent = true
+	if len(b.readers) == 0 {
+		return nil
+	}
+
+	results := b.impl.db.handle.SendBatch(ctx, &b.batch)
+	var firstErr error
+	for _, read := range b.readers {
+		err := read(ctx, results)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	err := results.Close()
+	if err != nil && firstErr == nil {
+		firstErr = b.impl.client.errorConverter(err)
+	}
+	return firstErr
+}
+{{- end }}
 `))
@@ -5,17 +5,28 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/opendoor/pggen/gen/internal/config"
 	"github.com/opendoor/pggen/gen/internal/utils"
 )
 
-func (g *Generator) genPrelude() error {
+func (g *Generator) genPrelude(conf *config.DbConfig) error {
 	var out strings.Builder
 
 	type PreludeTmplCtx struct {
 		Pkg string
+		// true if the generated code talks to pgx directly rather than database/sql
+		Pgx bool
+		// true if any tables are configured with 'audit = true'
+		Audit bool
 	}
 	tmplCtx := PreludeTmplCtx{
 		Pkg: g.pkg,
+		Pgx: conf.Backend == config.BackendPgx,
+	}
+	for _, tc := range conf.Tables {
+		if tc.Audit {
+			tmplCtx.Audit = true
+		}
 	}
 	err := preludeTmpl.Execute(&out, tmplCtx)
 	if err != nil {
@@ -36,14 +47,178 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"math/rand"
+	{{- if .Pgx }}
+	"reflect"
+	{{- end }}
 	"strings"
 	"sync"
 	"time"
 	"github.com/jackc/pgconn"
+	{{- if .Pgx }}
+	"github.com/jackc/pgx/v4"
+	{{- end }}
 
 	"github.com/opendoor/pggen"
+	"github.com/opendoor/pggen/include"
+	{{- if .Audit }}
+	"github.com/opendoor/pggen/middleware"
+	{{- end }}
 )
 
+{{- if .Pgx }}
+
+// PGRows is the type of the result sets returned by the generated *Query methods
+type PGRows = *pggen.PgxRows
+
+// dbHandle is the connection, pool or transaction that a pgClientImpl talks to the
+// database through. It wraps a pgx handle in the same method set that database/sql
+// provides so that the same generated code can work with either backend.
+type dbHandle = pgxDB
+
+type pgxDB struct {
+	handle pggen.PgxHandle
+}
+
+func (db pgxDB) QueryContext(ctx context.Context, query string, args ...interface{}) (PGRows, error) {
+	rows, err := db.handle.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &pggen.PgxRows{Rows: rows}, nil
+}
+
+func (db pgxDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	tag, err := db.handle.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxResult{tag: tag}, nil
+}
+
+func (db pgxDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) pgxRow {
+	return pgxRow{row: db.handle.QueryRow(ctx, query, args...)}
+}
+
+// pgxRow translates pgx.ErrNoRows into sql.ErrNoRows so that callers can check for
+// missing rows the same way with either backend
+type pgxRow struct {
+	row pgx.Row
+}
+
+func (r pgxRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if err == pgx.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+type pgxResult struct {
+	tag pgconn.CommandTag
+}
+
+func (r pgxResult) LastInsertId() (int64, error) {
+	return 0, fmt.Errorf("LastInsertId is not supported by postgres, use a RETURNING clause")
+}
+
+func (r pgxResult) RowsAffected() (int64, error) {
+	return r.tag.RowsAffected(), nil
+}
+
+// errTxDone is the error returned when committing or rolling back a transaction
+// which has already been committed or rolled back
+var errTxDone = pgx.ErrTxClosed
+
+// isPool returns true if the handle is a connection pool which can run several
+// queries at once. We can't name the pgxpool types without making everyone depend
+// on pgxpool, so we look for its Acquire method instead.
+func isPool(db dbHandle) bool {
+	_, inTx := db.handle.(pgx.Tx)
+	return !inTx && reflect.ValueOf(db.handle).MethodByName("Acquire").IsValid()
+}
+
+func isTx(db dbHandle) bool {
+	_, inTx := db.handle.(pgx.Tx)
+	return inTx
+}
+
+// beginTx starts a new transaction on the given handle
+func beginTx(ctx context.Context, db dbHandle, opts *sql.TxOptions) (dbHandle, error) {
+	beginner, ok := db.handle.(pggen.PgxConn)
+	if !ok {
+		return dbHandle{}, fmt.Errorf("cannot begin a transaction on a %T", db.handle)
+	}
+	pgxOpts, err := pggen.PgxTxOptions(opts)
+	if err != nil {
+		return dbHandle{}, err
+	}
+
+	tx, err := beginner.BeginTx(ctx, pgxOpts)
+	if err != nil {
+		return dbHandle{}, err
+	}
+	return pgxDB{handle: tx}, nil
+}
+
+func commitTx(tx dbHandle) error {
+	return tx.handle.(pgx.Tx).Commit(context.Background())
+}
+
+func rollbackTx(tx dbHandle) error {
+	return tx.handle.(pgx.Tx).Rollback(context.Background())
+}
+
+{{- else }}
+
+// PGRows is the type of the result sets returned by the generated *Query methods
+type PGRows = *sql.Rows
+
+// dbHandle is the connection, pool or transaction that a pgClientImpl talks to the
+// database through.
+type dbHandle = pggen.DBHandle
+
+// errTxDone is the error returned when committing or rolling back a transaction
+// which has already been committed or rolled back
+var errTxDone = sql.ErrTxDone
+
+// isPool returns true if the handle is a connection pool which can run several
+// queries at once
+func isPool(db dbHandle) bool {
+	_, isPool := db.(pggen.DBConn)
+	return isPool
+}
+
+func isTx(db dbHandle) bool {
+	_, inTx := db.(*sql.Tx)
+	return inTx
+}
+
+// beginTx starts a new transaction on the given handle
+func beginTx(ctx context.Context, db dbHandle, opts *sql.TxOptions) (dbHandle, error) {
+	beginner, ok := db.(interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("cannot begin a transaction on a %T", db)
+	}
+
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func commitTx(tx dbHandle) error {
+	return tx.(*sql.Tx).Commit()
+}
+
+func rollbackTx(tx dbHandle) error {
+	return tx.(*sql.Tx).Rollback()
+}
+{{- end }}
+
 type fieldNameAndIdx struct {
 	name string
 	idx int
@@ -183,11 +358,173 @@ func parenWrap(in string) string {
 	return "(" + in + ")"
 }
 
+// loadedRecordTable tracks the records which have been loaded while filling
+// in an include spec, keyed by table name, so that no record gets loaded twice.
+// Sibling branches of an include spec may be filled in from different goroutines,
+// so 'mu' must be held while touching the table or any of the records it points
+// to. The lock is never held while waiting on the database.
+type loadedRecordTable struct {
+	mu   sync.Mutex
+	tabs map[string]interface{}
+	// bounds the number of queries in flight at once. nil when branches
+	// are filled one after another.
+	sem chan struct{}
+	// bounds the number of goroutines filling branches at once. Separate from
+	// 'sem' because a branch holds its slot while its own queries run.
+	branchSem chan struct{}
+	// if true, soft deleted records get loaded along with everything else
+	includeDeleted bool
+}
+
+func newLoadedRecordTable(db dbHandle, opts []pggen.IncludeOpt) *loadedRecordTable {
+	options := pggen.IncludeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	tab := &loadedRecordTable{
+		tabs:           map[string]interface{}{},
+		includeDeleted: options.IncludeDeleted,
+	}
+	// transactions and dedicated connections can only run one query at a time,
+	// so we only go parallel when we have a whole connection pool to play with.
+	if isPool(db) && options.MaxConcurrency > 1 {
+		tab.sem = make(chan struct{}, options.MaxConcurrency)
+		tab.branchSem = make(chan struct{}, options.MaxConcurrency)
+	}
+	return tab
+}
+
+// acquireQuerySlot blocks until there is room for another query to be issued
+func (t *loadedRecordTable) acquireQuerySlot() {
+	if t.sem != nil {
+		t.sem <- struct{}{}
+	}
+}
+
+func (t *loadedRecordTable) releaseQuerySlot() {
+	if t.sem != nil {
+		<-t.sem
+	}
+}
+
+// fillBranches runs the given branches of an include spec, in parallel if
+// the table was set up for concurrent fetching, and returns the first error
+// encountered. Once the limit on concurrent branches has been reached, the
+// remaining branches are run by the calling goroutine.
+func (t *loadedRecordTable) fillBranches(branches []func() error) error {
+	if t.sem == nil || len(branches) < 2 {
+		for _, branch := range branches {
+			err := branch()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(branches))
+	var wg sync.WaitGroup
+	for i := range branches {
+		select {
+		case t.branchSem <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-t.branchSem
+					wg.Done()
+				}()
+				errs[i] = branches[i]()
+			}(i)
+		default:
+			errs[i] = branches[i]()
+		}
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genModifiedFillQuery generates the query used to load the child records for
+// a child in an include spec which has modifiers attached to it. Each parent
+// key gets its own lateral subquery so that orderings and limits apply to the
+// children of each parent separately. The child table is aliased as
+// 'pggen_child', and 'joinAndWhere' should restrict the child records to those
+// pointing at 'pggen_parents.pggen_parent_id'.
+func genModifiedFillQuery(
+	parentKeyType string,
+	childTable string,
+	selectList string,
+	joinAndWhere string,
+	childColIdxTab map[string]int,
+	childPredicates map[string]string,
+	mods *include.Modifiers,
+) (string, error) {
+	childRel := childTable
+	if len(mods.Where) > 0 {
+		preds := make([]string, 0, len(mods.Where))
+		for _, name := range mods.Where {
+			pred, ok := childPredicates[name]
+			if !ok {
+				return "", fmt.Errorf(
+					"include spec: '%s' has no include predicate named '%s'", childTable, name)
+			}
+			preds = append(preds, parenWrap(pred))
+		}
+		childRel = parenWrap("SELECT * FROM " + childTable + " WHERE " + strings.Join(preds, " AND "))
+	}
+
+	innerOrder := make([]string, 0, len(mods.OrderBy))
+	outerOrder := make([]string, 0, len(mods.OrderBy) + 1)
+	outerOrder = append(outerOrder, "pggen_parents.pggen_parent_ord")
+	for _, term := range mods.OrderBy {
+		_, ok := childColIdxTab[term.Column]
+		if !ok {
+			return "", fmt.Errorf(
+				"include spec: cannot order by unknown column '%s' of '%s'", term.Column, childTable)
+		}
+		col := "\"" + strings.ReplaceAll(term.Column, "\"", "\"\"") + "\""
+		dir := ""
+		if term.Desc {
+			dir = " DESC"
+		}
+		innerOrder = append(innerOrder, "pggen_child." + col + dir)
+		outerOrder = append(outerOrder, "pggen_filled." + col + dir)
+	}
+
+	var ret strings.Builder
+	ret.WriteString("SELECT pggen_filled.* FROM unnest($1::")
+	ret.WriteString(parentKeyType)
+	ret.WriteString("[]) WITH ORDINALITY AS pggen_parents(pggen_parent_id, pggen_parent_ord) ")
+	ret.WriteString("CROSS JOIN LATERAL (SELECT ")
+	ret.WriteString(selectList)
+	ret.WriteString(" FROM ")
+	ret.WriteString(childRel)
+	ret.WriteString(" pggen_child ")
+	ret.WriteString(joinAndWhere)
+	if len(innerOrder) > 0 {
+		ret.WriteString(" ORDER BY ")
+		ret.WriteString(strings.Join(innerOrder, ", "))
+	}
+	if mods.Limit > 0 {
+		ret.WriteString(fmt.Sprintf(" LIMIT %d", mods.Limit))
+	}
+	ret.WriteString(") pggen_filled ORDER BY ")
+	ret.WriteString(strings.Join(outerOrder, ", "))
+
+	return ret.String(), nil
+}
+
 func (p *PGClient) fillColPosTab(
 	ctx context.Context,
 	genTimeColIdxTab map[string]int,
 	rwlock *sync.RWMutex,
-	rows *sql.Rows,
+	rows PGRows,
 	tab *[]int, // out
 ) error {
 	// We need to ensure that writes to the slice header are atomic. We want to
@@ -227,7 +564,7 @@ func (p *PGClient) fillColPosTab(
 	return nil
 }
 
-func (p *pgClientImpl) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+func (p *pgClientImpl) queryContext(ctx context.Context, query string, args ...interface{}) (PGRows, error) {
 	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		if isInvalidCachedPlanError(err) {
@@ -252,6 +589,236 @@ func isInvalidCachedPlanError(err error) bool {
 		   pgxErr.Message == "cached plan must not change result type"
 }
 
+// txHooks holds the routines to be run once a transaction finishes. It is shared
+// between a transaction and all the savepoints within it.
+type txHooks struct {
+	mu         sync.Mutex
+	onCommit   []func()
+	onRollback []func()
+}
+
+// txHooksMark records how many hooks were registered at some point in time (the
+// establishment of a savepoint) so that the hooks registered since can be discarded.
+type txHooksMark struct {
+	nOnCommit   int
+	nOnRollback int
+}
+
+func (h *txHooks) addOnCommit(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onCommit = append(h.onCommit, fn)
+}
+
+func (h *txHooks) addOnRollback(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onRollback = append(h.onRollback, fn)
+}
+
+func (h *txHooks) mark() txHooksMark {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return txHooksMark{nOnCommit: len(h.onCommit), nOnRollback: len(h.onRollback)}
+}
+
+// rollbackTo discards all the hooks registered since the given mark, running the
+// rollback hooks among them since the work that they were registered for is gone.
+func (h *txHooks) rollbackTo(m txHooksMark) {
+	h.mu.Lock()
+	var toRun []func()
+	if m.nOnRollback <= len(h.onRollback) {
+		toRun = h.onRollback[m.nOnRollback:]
+		h.onRollback = h.onRollback[:m.nOnRollback:m.nOnRollback]
+	}
+	if m.nOnCommit <= len(h.onCommit) {
+		h.onCommit = h.onCommit[:m.nOnCommit:m.nOnCommit]
+	}
+	h.mu.Unlock()
+
+	for _, fn := range toRun {
+		fn()
+	}
+}
+
+// finish runs either the commit or the rollback hooks, and then forgets about all
+// of them so that they can never run twice.
+func (h *txHooks) finish(committed bool) {
+	h.mu.Lock()
+	toRun := h.onRollback
+	if committed {
+		toRun = h.onCommit
+	}
+	h.onCommit = nil
+	h.onRollback = nil
+	h.mu.Unlock()
+
+	for _, fn := range toRun {
+		fn()
+	}
+}
+
+// emitChange reports the given change to the listener attached to the context, if
+// any. Within a transaction, the report is put off until the transaction commits.
+func (p *pgClientImpl) emitChange(ctx context.Context, event pggen.ChangeEvent) {
+	listener := pggen.ChangeListenerFromContext(ctx)
+	if listener == nil {
+		return
+	}
+
+	if p.hooks == nil {
+		listener(event)
+		return
+	}
+	p.hooks.addOnCommit(func() {
+		listener(event)
+	})
+}
+
+// quoteIdent quotes the given name so that it can be used as an identifier in a query
+func quoteIdent(name string) string {
+	return ` + "`" + `"` + "`" + ` + strings.ReplaceAll(name, ` + "`" + `"` + "`" + `, ` + "`" + `""` + "`" + `) + ` + "`" + `"` + "`" + `
+}
+
+// retryTx calls 'attempt' until it succeeds, it fails with an error that retrying
+// will not fix, or we run out of retries. Serialization failures and deadlocks
+// are the only errors worth retrying.
+func retryTx(ctx context.Context, opts *pggen.TxOptions, attempt func() error) error {
+	maxRetries := pggen.DefaultTxMaxRetries
+	backoff := pggen.DefaultTxBackoff
+	if opts != nil {
+		// zero values fall back to the defaults, negative ones turn the setting off
+		if opts.MaxRetries < 0 {
+			maxRetries = 0
+		} else if opts.MaxRetries > 0 {
+			maxRetries = opts.MaxRetries
+		}
+		if opts.Backoff < 0 {
+			backoff = 0
+		} else if opts.Backoff > 0 {
+			backoff = opts.Backoff
+		}
+	}
+
+	for retry := 0; ; retry++ {
+		err := attempt()
+		if err == nil || retry >= maxRetries {
+			return err
+		}
+		if !pggen.IsSerializationFailure(err) && !pggen.IsDeadlock(err) {
+			return err
+		}
+
+		// add some jitter so that the transactions which just collided don't
+		// collide again on the retry
+		wait := backoff
+		if backoff > 0 {
+			wait += time.Duration(rand.Int63n(int64(backoff)))
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// rowLockClause returns the clause to append to a query in order to take the
+// given row lock, or an error if the lock cannot be taken. Row locks are only
+// held until the end of the current transaction, so taking them outside of a
+// transaction would be pointless.
+func (p *pgClientImpl) rowLockClause(strength string, wait string) (string, error) {
+	if strength == "" {
+		if wait != "" {
+			return "", fmt.Errorf("%s given without a row lock strength", wait)
+		}
+		return "", nil
+	}
+
+	if !isTx(p.db) {
+		return "", fmt.Errorf("row locks (%s) may only be taken within a transaction", strength)
+	}
+
+	clause := " " + strength
+	if wait != "" {
+		clause += " " + wait
+	}
+	return clause, nil
+}
+
+// runInTx runs the given routine in a transaction, committing if it succeeds and
+// rolling back if it fails. If the client is already operating within a transaction,
+// the routine just runs in the existing transaction.
+func (p *pgClientImpl) runInTx(ctx context.Context, fn func(txImpl *pgClientImpl) error) error {
+	if isTx(p.db) {
+		return fn(p)
+	}
+
+	tx, err := beginTx(ctx, p.db, nil)
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+
+	txImpl := &pgClientImpl{db: tx, client: p.client, hooks: &txHooks{}}
+	err = fn(txImpl)
+	if err != nil {
+		_ = rollbackTx(tx)
+		txImpl.hooks.finish(false)
+		return err
+	}
+
+	err = commitTx(tx)
+	if err != nil {
+		txImpl.hooks.finish(false)
+		return p.client.errorConverter(err)
+	}
+	txImpl.hooks.finish(true)
+	return nil
+}
+
+{{- if .Audit }}
+
+// auditActorSetKey marks a context as one which has already had its actor recorded
+// for the history triggers on audited tables
+type auditActorSetKey struct{}
+
+// withAuditActor runs the given routine, which writes to an audited table, with the
+// actor from 'ctx' recorded where the table's history trigger can find it. The actor
+// lives in a transaction local setting, so the routine runs in a transaction unless
+// there is no actor to record and no transaction to clear an earlier actor from. The
+// routine gets a context marking the actor as recorded, which it should check before
+// calling withAuditActor so that it doesn't recurse forever.
+func (p *pgClientImpl) withAuditActor(
+	ctx context.Context,
+	fn func(ctx context.Context, txImpl *pgClientImpl) error,
+) error {
+	ctx = context.WithValue(ctx, auditActorSetKey{}, true)
+	actor, hasActor := middleware.ActorFromContext(ctx)
+	if !hasActor && !isTx(p.db) {
+		return fn(ctx, p)
+	}
+
+	return p.runInTx(ctx, func(txImpl *pgClientImpl) error {
+		_, err := txImpl.db.ExecContext(
+			ctx,
+			"SELECT set_config('pggen.audit_actor', $1, true)",
+			actor,
+		)
+		if err != nil {
+			return txImpl.client.errorConverter(err)
+		}
+		return fn(ctx, txImpl)
+	})
+}
+
+// auditActorSet returns true if the actor in the given context has already
+// been recorded by withAuditActor
+func auditActorSet(ctx context.Context) bool {
+	return ctx.Value(auditActorSetKey{}) != nil
+}
+{{- end }}
+
 func convertNullString(s sql.NullString) *string {
 	if s.Valid {
 		return &s.String
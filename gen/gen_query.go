@@ -14,6 +14,7 @@ func (g *Generator) genQueries(
 	into *strings.Builder,
 	queries []config.QueryConfig,
 	requireComments bool,
+	genBatch bool,
 ) error {
 	if len(queries) > 0 {
 		g.log.Infof("	generating %d queries\n", len(queries))
@@ -38,7 +39,7 @@ func (g *Generator) genQueries(
 			return fmt.Errorf("query '%s' is missing a comment but require_query_comments is set", query.Name)
 		}
 
-		err := g.genQuery(into, &queries[i], nil)
+		err := g.genQuery(into, &queries[i], nil, genBatch)
 		if err != nil {
 			return fmt.Errorf("generating query '%s': %s", query.Name, err.Error())
 		}
@@ -48,11 +49,13 @@ func (g *Generator) genQueries(
 }
 
 // generate a query for the given config. If `args` is provided, use it
-// instead of the inferred argument types.
+// instead of the inferred argument types. If `genBatch` is true, a method to
+// queue the query on a PGBatch is generated as well.
 func (g *Generator) genQuery(
 	into *strings.Builder,
 	config *config.QueryConfig,
 	args []meta.Arg,
+	genBatch bool,
 ) error {
 	g.log.Infof("		generating query '%s'\n", config.Name)
 
@@ -81,49 +84,74 @@ func (g *Generator) genQuery(
 	}
 
 	if meta.MultiReturn {
-		genCtx := buildTableGenCtx(&meta)
+		genCtx := buildTableGenCtx(meta.ConfigData.Name, meta.ReturnCols)
 		err = g.typeResolver.EmitStructType(meta.ReturnTypeName, &genCtx)
 		if err != nil {
 			return fmt.Errorf("generating return struct for '%s': %s", config.Name, err.Error())
 		}
 	}
 
-	return queryShimTmpl.Execute(into, meta)
+	err = queryShimTmpl.Execute(into, meta)
+	if err != nil {
+		return err
+	}
+
+	if genBatch {
+		return queryBatchTmpl.Execute(into, meta)
+	}
+	return nil
 }
 
-// buildTableGenCtx converts a meta.QueryMeta object into a fake table gen context
-// that is good enough to use to generate a return type and scan method.
+// buildTableGenCtx converts the name and result columns of a query or statement
+// into a fake table gen context that is good enough to use to generate a return
+// type and scan method.
 //
 // poison the strings so that mistakes are easier to spot
-func buildTableGenCtx(qm *meta.QueryMeta) meta.TableGenCtx {
+func buildTableGenCtx(name string, returnCols []meta.ColMeta) meta.TableGenCtx {
 	return meta.TableGenCtx{
 		PgName:         "BOGUS_PGNAME",
-		GoName:         qm.ConfigData.Name + "Row",
+		GoName:         name + "Row",
 		PkeyColIdx:     -1,
 		AllIncludeSpec: "BOGUS_ALL_INCLUDE_SPEC",
 		Meta: &meta.TableMeta{
 			Info: meta.PgTableInfo{
 				PgName:       "BOGUS_PGNAME-inner",
-				GoName:       qm.ConfigData.Name + "Row",
+				GoName:       name + "Row",
 				PluralGoName: "BOGUS_PLURAL_GONAME-inner",
-				Cols:         qm.ReturnCols,
+				Cols:         returnCols,
 			},
 		},
 	}
 }
 
 var queryShimTmpl = template.Must(template.New("query-shim").Parse(`
+{{- if .ConfigData.ArgsStruct }}
+// {{ .ConfigData.Name }}Params contains the arguments for {{ .ConfigData.Name }}
+type {{ .ConfigData.Name }}Params struct {
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .FieldName }} {{ .TypeInfo.NullName }}
+	{{- else }}
+	{{ .FieldName }} {{ .TypeInfo.Name }}
+	{{- end }}
+	{{- end }}
+}
+{{ end }}
 {{ if .ConfigData.SingleResult }}
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
+	{{- end }}
 {{- if (not .MultiReturn) }}
 ) (ret {{ .ReturnTypeName }}, err error) {
 {{- else }}
@@ -131,21 +159,31 @@ func (p *PGClient) {{ .ConfigData.Name }}(
 {{- end }}
 	return p.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args }}
 		{{ .GoName }},
 		{{- end }}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (tx *TxPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
+	{{- end }}
 {{- if (not .MultiReturn) }}
 ) (ret {{ .ReturnTypeName }}, err error) {
 {{- else }}
@@ -153,21 +191,31 @@ func (tx *TxPGClient) {{ .ConfigData.Name }}(
 {{- end }}
 	return tx.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args }}
 		{{ .GoName }},
 		{{- end }}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
+	{{- end }}
 {{- if (not .MultiReturn) }}
 ) (ret {{ .ReturnTypeName }}, err error) {
 {{- else }}
@@ -175,15 +223,21 @@ func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 {{- end }}
 	return conn.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args }}
 		{{ .GoName }},
 		{{- end }}
+		{{- end }}
 	)
 }
 func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -194,24 +248,18 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 {{- else }}
 ) (ret *{{ .ReturnTypeName }}, err error) {
 {{- end }}
-	{{- if (not .MultiReturn) }}
-	var zero {{ .ReturnTypeName }}
-	{{- else }}
-	var zero *{{ .ReturnTypeName }}
-	{{- end }}
-
 	// we still use QueryConfig rather than QueryRowContext so the scan
 	// impl remains consistant. We don't need to split out a seperate Query
 	// method though.
-	var rows *sql.Rows
+	var rows PGRows
 	{{- /* We can't call out to *Query method because this is in the SingleResult block. */}}
-	rows, err = p.queryContext(
+	rows, err = {{ if .ConfigData.ReadOnly }}p.forRead(ctx){{ else }}p{{ end }}.queryContext(
 		ctx,
 		` + "`" +
 	`{{ .ConfigData.Body }}` +
 	"`" + `,
 		{{- range .Args }}
-		{{- if $.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ call .TypeInfo.NullSqlArgument .GoName }},
 		{{- else }}
 		{{ call .TypeInfo.SqlArgument .GoName }},
@@ -219,8 +267,24 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 		{{- end }}
 	)
 	if err != nil {
-		return zero, p.client.errorConverter(err)
+		return ret, p.client.errorConverter(err)
 	}
+	return p.scan{{ .ConfigData.Name }}(ctx, rows)
+}
+
+// scan{{ .ConfigData.Name }} reads the result of a {{ .ConfigData.Name }} query out
+// of the given rows, closing them once it is done.
+func (p *pgClientImpl) scan{{ .ConfigData.Name }}(
+	ctx context.Context,
+	rows PGRows,
+{{- if (not .MultiReturn) }}
+) (ret {{ .ReturnTypeName }}, err error) {
+	var zero {{ .ReturnTypeName }}
+{{- else }}
+) (ret *{{ .ReturnTypeName }}, err error) {
+	var zero *{{ .ReturnTypeName }}
+{{- end }}
+
 	defer func() {
 		if err == nil {
 			err = rows.Close()
@@ -265,70 +329,98 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
+	{{- end }}
 ) (ret []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, err error) {
 	return p.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args }}
 		{{ .GoName }},
 		{{- end }}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (tx *TxPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
+	{{- end }}
 ) (ret []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, err error) {
 	return tx.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args }}
 		{{ .GoName }},
 		{{- end }}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
+	{{- end }}
 ) (ret []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, err error) {
 	return conn.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args }}
 		{{ .GoName }},
 		{{- end }}
+		{{- end }}
 	)
 }
 func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
 ) (ret []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, err error) {
-	ret = []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}{}
-
-	var rows *sql.Rows
+	var rows PGRows
 	rows, err = p.{{ .ConfigData.Name }}Query(
 		ctx,
 		{{- range .Args}}
@@ -338,6 +430,17 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	if err != nil {
 		return nil, p.client.errorConverter(err)
 	}
+	return p.scan{{ .ConfigData.Name }}(ctx, rows)
+}
+
+// scan{{ .ConfigData.Name }} reads the results of a {{ .ConfigData.Name }} query out
+// of the given rows, closing them once it is done.
+func (p *pgClientImpl) scan{{ .ConfigData.Name }}(
+	ctx context.Context,
+	rows PGRows,
+) (ret []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, err error) {
+	ret = []{{- if $.ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}{}
+
 	defer func() {
 		if err == nil {
 			err = rows.Close()
@@ -385,74 +488,104 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-) (*sql.Rows, error) {
+	{{- end }}
+) (PGRows, error) {
 	return p.impl.{{ .ConfigData.Name }}Query(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args}}
 		{{ .GoName }},
 		{{- end}}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (tx *TxPGClient) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-) (*sql.Rows, error) {
+	{{- end }}
+) (PGRows, error) {
 	return tx.impl.{{ .ConfigData.Name }}Query(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args}}
 		{{ .GoName }},
 		{{- end}}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (conn *ConnPGClient) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-) (*sql.Rows, error) {
+	{{- end }}
+) (PGRows, error) {
 	return conn.impl.{{ .ConfigData.Name }}Query(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args}}
 		{{ .GoName }},
 		{{- end}}
+		{{- end }}
 	)
 }
 func (p *pgClientImpl) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-) (*sql.Rows, error) {
-	return p.queryContext(
+) (PGRows, error) {
+	return {{ if .ConfigData.ReadOnly }}p.forRead(ctx){{ else }}p{{ end }}.queryContext(
 		ctx,
 		` + "`" +
 	`{{ .ConfigData.Body }}` +
 	"`" + `,
 		{{- range .Args }}
-		{{- if $.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ call .TypeInfo.NullSqlArgument .GoName }},
 		{{- else }}
 		{{ call .TypeInfo.SqlArgument .GoName }},
@@ -463,3 +596,85 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}Query(
 
 {{- end }}{{/* if .ConfigData.SingleResult */}}
 `))
+
+var queryBatchTmpl = template.Must(template.New("query-batch").Parse(`
+{{- define "retType" }}
+{{- if .ConfigData.SingleResult }}
+{{- if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}
+{{- else -}}
+[]{{- if .ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}
+{{- end }}
+{{- end }}
+
+// {{ .ConfigData.Name }}Future holds the result of a {{ .ConfigData.Name }} query
+// queued on a PGBatch. The result is available once the batch has been sent.
+type {{ .ConfigData.Name }}Future struct {
+	ret {{ template "retType" . }}
+	err error
+	done bool
+}
+
+// Get returns the result of the query. It is an error to call it before the batch
+// has been sent.
+func (f *{{ .ConfigData.Name }}Future) Get() ({{ template "retType" . }}, error) {
+	if !f.done {
+		return f.ret, fmt.Errorf("{{ .ConfigData.Name }}Future.Get: the batch has not been sent")
+	}
+	return f.ret, f.err
+}
+
+// Queue{{ .ConfigData.Name }} adds a {{ .ConfigData.Name }} query to the batch. Queueing
+// a query on a batch which has already been sent fails the returned future.
+func (b *PGBatch) Queue{{ .ConfigData.Name }}(
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+	{{- end }}
+) *{{ .ConfigData.Name }}Future {
+	future := &{{ .ConfigData.Name }}Future{}
+	if b.sent {
+		future.err = b.impl.client.errorConverter(
+			fmt.Errorf("PGBatch.Queue{{ .ConfigData.Name }}: the batch has already been sent"))
+		future.done = true
+		return future
+	}
+	b.batch.Queue(
+		` + "`" +
+	`{{ .ConfigData.Body }}` +
+	"`" + `,
+		{{- range .Args }}
+		{{- if $.ConfigData.ArgsStruct }}
+		{{- if .Nullable }}
+		{{ call .TypeInfo.NullSqlArgument (printf "params.%s" .FieldName) }},
+		{{- else }}
+		{{ call .TypeInfo.SqlArgument (printf "params.%s" .FieldName) }},
+		{{- end }}
+		{{- else }}
+		{{- if .Nullable }}
+		{{ call .TypeInfo.NullSqlArgument .GoName }},
+		{{- else }}
+		{{ call .TypeInfo.SqlArgument .GoName }},
+		{{- end }}
+		{{- end }}
+		{{- end }}
+	)
+	b.readers = append(b.readers, func(ctx context.Context, results pgx.BatchResults) error {
+		rows, err := results.Query()
+		if err != nil {
+			future.err = b.impl.client.errorConverter(err)
+		} else {
+			future.ret, future.err = b.impl.scan{{ .ConfigData.Name }}(ctx, &pggen.PgxRows{Rows: rows})
+		}
+		future.done = true
+		return future.err
+	})
+	return future
+}
+`))
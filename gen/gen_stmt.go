@@ -1,6 +1,7 @@
 package gen
 
 import (
+	"fmt"
 	"io"
 	"text/template"
 
@@ -33,86 +34,285 @@ func (g *Generator) genStmt(into io.Writer, stmt *config.StmtConfig) error {
 
 	stmt.Name = names.PgToGoName(stmt.Name)
 
+	// tables in non-public schemas are allowed to have underscores in their names, so
+	// we don't want to convert in that case.
+	if !g.typeResolver.Probe(stmt.ReturnType) {
+		stmt.ReturnType = names.PgToGoName(stmt.ReturnType)
+	}
+
 	meta, err := g.metaResolver.StmtMeta(stmt)
 	if err != nil {
-		return err
+		return fmt.Errorf("generating statement '%s': %s", stmt.Name, err.Error())
+	}
+
+	if meta.Returning {
+		g.imports[`"fmt"`] = true
+		g.imports[`"github.com/opendoor/pggen/unstable"`] = true
+		// HACK: not really a type, but the type resolver can be used to ensure that
+		//       exactly one copy of this declaration makes it into the final output.
+		err = g.typeResolver.EmitType("ensure-unstable-used", "sig", "var _ = unstable.NotFoundError{}")
+		if err != nil {
+			return fmt.Errorf("internal-error: emitting bogus NotFoundError usage: %s", err)
+		}
+	}
+
+	if meta.MultiReturn {
+		genCtx := buildTableGenCtx(meta.ConfigData.Name, meta.ReturnCols)
+		err = g.typeResolver.EmitStructType(meta.ReturnTypeName, &genCtx)
+		if err != nil {
+			return fmt.Errorf("generating return struct for '%s': %s", stmt.Name, err.Error())
+		}
+		g.stmtScanStructNames = append(g.stmtScanStructNames, meta.ReturnTypeName)
 	}
 
 	return stmtShimTmpl.Execute(into, meta)
 }
 
 var stmtShimTmpl *template.Template = template.Must(template.New("stmt-shim").Parse(`
+{{- if .ConfigData.ArgsStruct }}
+// {{ .ConfigData.Name }}Params contains the arguments for {{ .ConfigData.Name }}
+type {{ .ConfigData.Name }}Params struct {
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .FieldName }} {{ .TypeInfo.NullName }}
+	{{- else }}
+	{{ .FieldName }} {{ .TypeInfo.Name }}
+	{{- end }}
+	{{- end }}
+}
+{{ end }}
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
+	{{- end }}
+{{- if .Returning }}
+) (ret {{ if .ConfigData.SingleResult }}{{ if .MultiReturn }}*{{ end }}{{ else }}[]{{ end }}{{ .ReturnTypeName }}, rowsAffected int64, err error) {
+{{- else }}
 ) (sql.Result, error) {
+{{- end }}
 	return p.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args}}
 		{{ .GoName }},
 		{{- end}}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (tx *TxPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
+	{{- end }}
+{{- if .Returning }}
+) (ret {{ if .ConfigData.SingleResult }}{{ if .MultiReturn }}*{{ end }}{{ else }}[]{{ end }}{{ .ReturnTypeName }}, rowsAffected int64, err error) {
+{{- else }}
 ) (sql.Result, error) {
+{{- end }}
 	return tx.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args}}
 		{{ .GoName }},
 		{{- end}}
+		{{- end }}
 	)
 }
 {{ .Comment }}
 func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
+	{{- if .ConfigData.ArgsStruct }}
+	params {{ .ConfigData.Name }}Params,
+	{{- else }}
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
+	{{- end }}
+{{- if .Returning }}
+) (ret {{ if .ConfigData.SingleResult }}{{ if .MultiReturn }}*{{ end }}{{ else }}[]{{ end }}{{ .ReturnTypeName }}, rowsAffected int64, err error) {
+{{- else }}
 ) (sql.Result, error) {
+{{- end }}
 	return conn.impl.{{ .ConfigData.Name }}(
 		ctx,
+		{{- if .ConfigData.ArgsStruct }}
+		{{- range .Args }}
+		params.{{ .FieldName }},
+		{{- end }}
+		{{- else }}
 		{{- range .Args}}
 		{{ .GoName }},
 		{{- end}}
+		{{- end }}
 	)
 }
 func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
+{{- if .Returning }}
+) (ret {{ if .ConfigData.SingleResult }}{{ if .MultiReturn }}*{{ end }}{{ else }}[]{{ end }}{{ .ReturnTypeName }}, rowsAffected int64, err error) {
+{{- else }}
 ) (sql.Result, error) {
+{{- end }}
+{{- if .Returning }}
+	{{- if .ConfigData.SingleResult }}
+	{{- if .MultiReturn }}
+	var zero *{{ .ReturnTypeName }}
+	{{- else }}
+	var zero {{ .ReturnTypeName }}
+	{{- end }}
+	{{- else }}
+	ret = []{{ .ReturnTypeName }}{}
+	{{- end }}
+
+	var rows PGRows
+	rows, err = p.queryContext(
+		ctx,
+		` + "`" +
+	`{{ .ConfigData.Body }}` +
+	"`" + `,
+		{{- range .Args }}
+		{{- if .Nullable }}
+		{{ call .TypeInfo.NullSqlArgument .GoName }},
+		{{- else }}
+		{{ call .TypeInfo.SqlArgument .GoName }},
+		{{- end }}
+		{{- end }}
+	)
+	if err != nil {
+		{{- if .ConfigData.SingleResult }}
+		return zero, 0, p.client.errorConverter(err)
+		{{- else }}
+		return nil, 0, p.client.errorConverter(err)
+		{{- end }}
+	}
+	defer func() {
+		if err == nil {
+			err = rows.Close()
+			if err != nil {
+				{{- if .ConfigData.SingleResult }}
+				ret = zero
+				{{- else }}
+				ret = nil
+				{{- end }}
+				rowsAffected = 0
+				err = p.client.errorConverter(err)
+			}
+		} else {
+			rowErr := rows.Close()
+			if rowErr != nil {
+				err = p.client.errorConverter(fmt.Errorf("%s AND %s", err.Error(), rowErr.Error()))
+			}
+		}
+	}()
+
+	for rows.Next() {
+		rowsAffected++
+		{{- if .ConfigData.SingleResult }}
+		if rowsAffected > 1 {
+			// every returned row corresponds to an affected row, so we need to
+			// count them even though we only return the first one
+			continue
+		}
+		{{- end }}
+
+		var row {{ .ReturnTypeName }}
+		{{- if .MultiReturn }}
+		err = row.Scan(ctx, p.client, rows)
+		if err != nil {
+			{{- if .ConfigData.SingleResult }}
+			return zero, 0, p.client.errorConverter(err)
+			{{- else }}
+			return nil, 0, p.client.errorConverter(err)
+			{{- end }}
+		}
+		{{- else }}
+		{{- if (index .ReturnCols 0).Nullable }}
+		var scanTgt {{ (index .ReturnCols 0).TypeInfo.ScanNullName }}
+		err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.NullSqlReceiver "scanTgt" }})
+		if err != nil {
+			{{- if .ConfigData.SingleResult }}
+			return zero, 0, p.client.errorConverter(err)
+			{{- else }}
+			return nil, 0, p.client.errorConverter(err)
+			{{- end }}
+		}
+		row = {{ call (index .ReturnCols 0).TypeInfo.NullConvertFunc "scanTgt" }}
+		{{- else }}
+		err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.SqlReceiver "row" }})
+		if err != nil {
+			{{- if .ConfigData.SingleResult }}
+			return zero, 0, p.client.errorConverter(err)
+			{{- else }}
+			return nil, 0, p.client.errorConverter(err)
+			{{- end }}
+		}
+		{{- end }}
+		{{- end }}
+
+		{{- if .ConfigData.SingleResult }}
+		{{- if .MultiReturn }}
+		ret = &row
+		{{- else }}
+		ret = row
+		{{- end }}
+		{{- else }}
+		ret = append(ret, row)
+		{{- end }}
+	}
+
+	{{- if .ConfigData.SingleResult }}
+	if rowsAffected == 0 {
+		return zero, 0, p.client.errorConverter(&unstable.NotFoundError{ Msg: "{{ .ConfigData.Name }}: no results" })
+	}
+	{{- end }}
+
+	return
+{{- else }}
 	res, err := p.db.ExecContext(
 		ctx,
 		` + "`" +
 	`{{ .ConfigData.Body }}` +
 	"`" + `,
 		{{- range .Args }}
-		{{- if $.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ call .TypeInfo.NullSqlArgument .GoName }},
 		{{- else }}
 		{{ call .TypeInfo.SqlArgument .GoName }},
@@ -120,6 +320,7 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 		{{- end }}
 	)
 	return res, p.client.errorConverter(err)
+{{- end }}
 }
 
 `))
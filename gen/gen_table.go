@@ -34,8 +34,64 @@ func (g *Generator) genTables(into io.Writer, tables []config.TableConfig) error
 		}
 	}
 
-	return nil
+	return g.genIncludeGraph(into, tables)
+}
+
+// Generate the static graph of references between tables used to validate include specs,
+// along with the table of constraints used to report constraint violations.
+func (g *Generator) genIncludeGraph(into io.Writer, tables []config.TableConfig) error {
+	genCtxs := make([]meta.TableGenCtx, 0, len(tables))
+	for i := range tables {
+		tableInfo, ok := g.metaResolver.TableMeta(tables[i].Name)
+		if !ok {
+			return fmt.Errorf("could not get schema info about table '%s'", tables[i].Name)
+		}
+		genCtxs = append(genCtxs, tableGenCtxFromInfo(tableInfo))
+	}
+
+	err := includeGraphTmpl.Execute(into, genCtxs)
+	if err != nil {
+		return err
+	}
+	return constraintTableTmpl.Execute(into, genCtxs)
+}
+
+var constraintTableTmpl *template.Template = template.Must(template.New("constraint-table-tmpl").Parse(`
+
+// tableConstraints maps each table, as '<schema>.<table>', to its constraints and
+// the columns that they cover. It is used to turn constraint violations reported by
+// the database into *pggen.ConstraintViolationError values.
+var tableConstraints = map[string]map[string][]string{
+	{{- range . }}
+	` + "`" + `{{ .Meta.Info.PgSchema }}.{{ .Meta.Info.PgRelName }}` + "`" + `: {
+		{{- range .Meta.Info.Constraints }}
+		` + "`" + `{{ .PgName }}` + "`" + `: { {{- range $i, $col := .Cols }}{{ if $i }}, {{ end }}` + "`" + `{{ $col }}` + "`" + `{{ end -}} },
+		{{- end }}
+	},
+	{{- end }}
+}
+`))
+
+var includeGraphTmpl *template.Template = template.Must(template.New("include-graph-tmpl").Parse(`
+
+// includeGraph describes every reference between tables that an include spec may
+// traverse. It is used to validate include specs before they are filled in.
+var includeGraph include.Graph = include.Graph{
+	{{- range . }}
+	` + "`" + `{{ .PgName }}` + "`" + `: {
+		{{- range .Meta.AllIncomingReferences }}
+		` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `: ` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `,
+		{{- end }}
+		{{- range .Meta.AllOutgoingReferences }}
+		` + "`" + `{{ .PgPointsToFieldName }}` + "`" + `: ` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `,
+		{{- end }}
+		{{- range .Meta.AllThroughReferences }}
+		` + "`" + `{{ .PgFieldName }}` + "`" + `: ` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `,
+		{{- end }}
+	},
+	{{- end }}
 }
+`))
 
 func tableGenCtxFromInfo(info *meta.TableMeta) meta.TableGenCtx {
 	return meta.TableGenCtx{
@@ -80,7 +136,15 @@ func (g *Generator) genTable(
 		return
 	}
 
-	return tableShimTmpl.Execute(into, genCtx)
+	err = tableShimTmpl.Execute(into, genCtx)
+	if err != nil {
+		return
+	}
+
+	if table.Audit {
+		err = g.genAudit(into, &genCtx)
+	}
+	return
 }
 
 var tableShimTmpl *template.Template = template.Must(template.New("table-shim-tmpl").Parse(`
@@ -90,28 +154,46 @@ func (p *PGClient) Get{{ .GoName }}(
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) (*{{ .GoName }}, error) {
-	return p.impl.get{{ .GoName }}(ctx, id)
+	return p.impl.get{{ .GoName }}(ctx, id, opts...)
 }
 func (tx *TxPGClient) Get{{ .GoName }}(
 	ctx context.Context,
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) (*{{ .GoName }}, error) {
-	return tx.impl.get{{ .GoName }}(ctx, id)
+	return tx.impl.get{{ .GoName }}(ctx, id, opts...)
 }
 func (conn *ConnPGClient) Get{{ .GoName }}(
 	ctx context.Context,
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) (*{{ .GoName }}, error) {
-	return conn.impl.get{{ .GoName }}(ctx, id)
+	return conn.impl.get{{ .GoName }}(ctx, id, opts...)
 }
 func (p *pgClientImpl) get{{ .GoName }}(
 	ctx context.Context,
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) (*{{ .GoName }}, error) {
-	values, err := p.list{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id}, true /* isGet */)
+	opt := pggen.GetOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	var listOpts []pggen.ListOpt
+	if opt.Includes != nil {
+		listOpts = append(listOpts, pggen.ListWithIncludes(opt.Includes, opt.IncludeOpts...))
+	}
+	if opt.IncludeDeleted {
+		listOpts = append(listOpts, pggen.ListIncludeDeleted)
+	}
+	if opt.LockStrength != "" || opt.LockWait != "" {
+		listOpts = append(listOpts, func(listOpt *pggen.ListOptions) {
+			listOpt.LockStrength = opt.LockStrength
+			listOpt.LockWait = opt.LockWait
+		})
+	}
+
+	values, err := p.list{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id}, true /* isGet */, listOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -152,16 +234,38 @@ func (p *pgClientImpl) list{{ .GoName }}(
 	for _, o := range opts {
 		o(&opt)
 	}
+	var missingIDs *[]{{ .PkeyCol.TypeInfo.Name }}
+	if opt.Missing != nil {
+		var ok bool
+		missingIDs, ok = opt.Missing.(*[]{{ .PkeyCol.TypeInfo.Name }})
+		if !ok {
+			return nil, p.client.errorConverter(fmt.Errorf(
+				"List{{ .GoName }}: ListMissing expects a *[]{{ .PkeyCol.TypeInfo.Name }}, got a %T",
+				opt.Missing,
+			))
+		}
+		*missingIDs = []{{ .PkeyCol.TypeInfo.Name }}{}
+	}
 	if len(ids) == 0 {
 		return []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}, nil
 	}
 
-	rows, err := p.queryContext(
-		ctx,
-		` + "`" + `SELECT * FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)
-		{{- if .Meta.HasDeletedAtField }} AND "{{ .Meta.PgDeletedAtField }}" IS NULL {{ end }}` + "`" + `,
-		pgtypes.Array(ids),
-	)
+	query := ` + "`" + `SELECT * FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `
+	{{- if .Meta.HasDeletedAtField }}
+	if !opt.IncludeDeleted {
+		query += ` + "`" + ` AND "{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+	lockClause, err := p.rowLockClause(opt.LockStrength, opt.LockWait)
+	if err != nil {
+		return nil, p.client.errorConverter(err)
+	}
+	query += lockClause
+
+	// the includes get filled from the same replica as the records they hang off
+	// of, so that they can't come from a replica which is further behind.
+	reader := p.forRead(ctx)
+	rows, err := reader.queryContext(ctx, query, pgtypes.Array(ids))
 	if err != nil {
 		return nil, p.client.errorConverter(err)
 	}
@@ -190,6 +294,31 @@ func (p *pgClientImpl) list{{ .GoName }}(
 		ret = append(ret, {{- if .Meta.Config.BoxResults }}&{{- end }}value)
 	}
 
+	// postgres hands back the records in whatever order it likes, so put them
+	// back in the order in which they were asked for. Each id gets marked with
+	// -1 once it has been dealt with so that duplicate ids are only considered once.
+	idToIdx := make(map[{{ .PkeyCol.TypeInfo.Name }}]int, len(ret))
+	for i := range ret {
+		idToIdx[ret[i].{{ .PkeyCol.GoName }}] = i
+	}
+	ordered := make([]{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, 0, len(ret))
+	for _, id := range ids {
+		idx, found := idToIdx[id]
+		if !found {
+			if missingIDs != nil {
+				*missingIDs = append(*missingIDs, id)
+			}
+			idToIdx[id] = -1
+			continue
+		}
+		if idx < 0 {
+			continue
+		}
+		ordered = append(ordered, ret[idx])
+		idToIdx[id] = -1
+	}
+	ret = ordered
+
 	if len(ret) != len(ids) {
 		if isGet {
 			return nil, p.client.errorConverter(&unstable.NotFoundError{
@@ -206,6 +335,149 @@ func (p *pgClientImpl) list{{ .GoName }}(
 		}
 	}
 
+	if opt.Includes != nil {
+		// the fill starts its table of loaded records off with the records we just
+		// fetched, so they won't get loaded a second time if the spec loops back to them.
+		{{- if .Meta.Config.BoxResults }}
+		err = reader.private{{ .GoName }}BulkFillIncludes(ctx, ret, opt.Includes, opt.IncludeOpts...)
+		{{- else }}
+		recs := make([]*{{ .GoName }}, 0, len(ret))
+		for i := range ret {
+			recs = append(recs, &ret[i])
+		}
+		err = reader.private{{ .GoName }}BulkFillIncludes(ctx, recs, opt.Includes, opt.IncludeOpts...)
+		{{- end }}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// List{{ .GoName }}Map works just like List{{ .GoName }}, except that it returns the records
+// keyed by their primary key. Ids which could not be found are simply left out
+// of the map rather than causing an error.
+func (p *PGClient) List{{ .GoName }}Map(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) (map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }}, error) {
+	return p.impl.list{{ .GoName }}Map(ctx, ids, opts...)
+}
+func (tx *TxPGClient) List{{ .GoName }}Map(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) (map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }}, error) {
+	return tx.impl.list{{ .GoName }}Map(ctx, ids, opts...)
+}
+func (conn *ConnPGClient) List{{ .GoName }}Map(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) (map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }}, error) {
+	return conn.impl.list{{ .GoName }}Map(ctx, ids, opts...)
+}
+func (p *pgClientImpl) list{{ .GoName }}Map(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) (map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }}, error) {
+	listOpts := make([]pggen.ListOpt, 0, len(opts)+1)
+	listOpts = append(listOpts, opts...)
+	listOpts = append(listOpts, pggen.ListSucceedOnPartialResults)
+	values, err := p.list{{ .GoName }}(ctx, ids, false /* isGet */, listOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }}, len(values))
+	for i := range values {
+		ret[values[i].{{ .PkeyCol.GoName }}] = {{ if (not .Meta.Config.BoxResults) }}&{{- end }}values[i]
+	}
+	return ret, nil
+}
+
+// Claim{{ .GoName }} locks and returns up to 'limit' {{ .GoName }} records matching
+// 'filter' which are not already locked by another transaction, making it easy to use
+// the table as a work queue. 'filter' is a SQL boolean expression over the columns
+// of the table which may refer to 'args' using $1 through $n placeholders. It gets
+// pasted directly into the query, so any untrusted values must be passed through 'args'
+// rather than built into the filter. An empty filter matches every record. The records
+// stay locked until the transaction ends.
+func (tx *TxPGClient) Claim{{ .GoName }}(
+	ctx context.Context,
+	limit int,
+	filter string,
+	args ...interface{},
+) (ret []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, err error) {
+	return tx.impl.claim{{ .GoName }}(ctx, limit, filter, args...)
+}
+func (p *pgClientImpl) claim{{ .GoName }}(
+	ctx context.Context,
+	limit int,
+	filter string,
+	args ...interface{},
+) (ret []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, err error) {
+	lockClause, err := p.rowLockClause(pggen.LockForUpdate, pggen.LockSkipLocked)
+	if err != nil {
+		return nil, p.client.errorConverter(err)
+	}
+	if limit <= 0 {
+		return []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}, nil
+	}
+
+	var conds []string
+	if filter != "" {
+		conds = append(conds, parenWrap(filter))
+	}
+	{{- if .Meta.HasDeletedAtField }}
+	conds = append(conds, ` + "`" + `"{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `)
+	{{- end }}
+
+	query := ` + "`" + `SELECT * FROM {{ .PgName }}` + "`" + `
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// the limit comes after any arguments to the filter
+	query += fmt.Sprintf(` + "`" + ` ORDER BY "{{ .PkeyCol.PgName }}" LIMIT $%d` + "`" + `, len(args)+1) + lockClause
+
+	// copy the arguments so that we don't scribble over the caller's slice
+	queryArgs := make([]interface{}, 0, len(args)+1)
+	queryArgs = append(append(queryArgs, args...), limit)
+
+	rows, err := p.queryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, p.client.errorConverter(err)
+	}
+	defer func() {
+		if err == nil {
+			err = rows.Close()
+			if err != nil {
+				ret = nil
+				err = p.client.errorConverter(err)
+			}
+		} else {
+			rowErr := rows.Close()
+			if rowErr != nil {
+				err = p.client.errorConverter(fmt.Errorf("%s AND %s", err.Error(), rowErr.Error()))
+			}
+		}
+	}()
+
+	// the limit may be far larger than the number of records that can be claimed,
+	// so we don't use it to size the result
+	ret = []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}
+	for rows.Next() {
+		var value {{ .GoName }}
+		err = value.Scan(ctx, p.client, rows)
+		if err != nil {
+			return nil, p.client.errorConverter(err)
+		}
+		ret = append(ret, {{- if .Meta.Config.BoxResults }}&{{- end }}value)
+	}
+
 	return ret, nil
 }
 
@@ -291,6 +563,16 @@ func (p *pgClientImpl) bulkInsert{{ .GoName }}(
 	values []{{ .GoName }},
 	opts ...pggen.InsertOpt,
 ) ([]{{ .PkeyCol.TypeInfo.Name }}, error) {
+	{{- if .Meta.Config.Audit }}
+	if !auditActorSet(ctx) {
+		var ret []{{ .PkeyCol.TypeInfo.Name }}
+		err := p.withAuditActor(ctx, func(ctx context.Context, txImpl *pgClientImpl) (err error) {
+			ret, err = txImpl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+			return
+		})
+		return ret, err
+	}
+	{{- end }}
 	if len(values) == 0 {
 		return []{{ .PkeyCol.TypeInfo.Name }}{}, nil
 	}
@@ -393,9 +675,152 @@ func (p *pgClientImpl) bulkInsert{{ .GoName }}(
 		ids = append(ids, id)
 	}
 
+	p.emitChange(ctx, pggen.ChangeEvent{
+		Table: ` + "`" + `{{ .Meta.Info.PgRelName }}` + "`" + `,
+		Op:    pggen.ChangeInsert,
+		IDs:   ids,
+	})
+
 	return ids, nil
 }
 
+// Insert a {{ .GoName }} along with the child records attached to it. Children
+// are inserted for every reference in the include spec, and have their foreign keys
+// pointed at the newly inserted parent. Returns the primary key of the inserted row.
+// The insert options only apply to the {{ .GoName }} itself. The children are always
+// inserted with the default options.
+// The whole graph is inserted within a single transaction.
+func (p *PGClient) Insert{{ .GoName }}Graph(
+	ctx context.Context,
+	value *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.InsertOpt,
+) (ret {{ .PkeyCol.TypeInfo.Name }}, err error) {
+	return p.impl.insert{{ .GoName }}Graph(ctx, value, includes, opts...)
+}
+// Insert a {{ .GoName }} along with the child records attached to it. Children
+// are inserted for every reference in the include spec, and have their foreign keys
+// pointed at the newly inserted parent. Returns the primary key of the inserted row.
+// The insert options only apply to the {{ .GoName }} itself. The children are always
+// inserted with the default options.
+func (tx *TxPGClient) Insert{{ .GoName }}Graph(
+	ctx context.Context,
+	value *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.InsertOpt,
+) (ret {{ .PkeyCol.TypeInfo.Name }}, err error) {
+	return tx.impl.insert{{ .GoName }}Graph(ctx, value, includes, opts...)
+}
+// Insert a {{ .GoName }} along with the child records attached to it. Children
+// are inserted for every reference in the include spec, and have their foreign keys
+// pointed at the newly inserted parent. Returns the primary key of the inserted row.
+// The insert options only apply to the {{ .GoName }} itself. The children are always
+// inserted with the default options.
+// The whole graph is inserted within a single transaction.
+func (conn *ConnPGClient) Insert{{ .GoName }}Graph(
+	ctx context.Context,
+	value *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.InsertOpt,
+) (ret {{ .PkeyCol.TypeInfo.Name }}, err error) {
+	return conn.impl.insert{{ .GoName }}Graph(ctx, value, includes, opts...)
+}
+func (p *pgClientImpl) insert{{ .GoName }}Graph(
+	ctx context.Context,
+	value *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.InsertOpt,
+) (ret {{ .PkeyCol.TypeInfo.Name }}, err error) {
+	err = Validate{{ .GoName }}Includes(includes)
+	if err != nil {
+		return ret, p.client.errorConverter(err)
+	}
+
+	err = p.runInTx(ctx, func(txImpl *pgClientImpl) error {
+		return txImpl.bulkInsert{{ .GoName }}Graph(ctx, []*{{ .GoName }}{value}, includes, opts...)
+	})
+	if err != nil {
+		return ret, err
+	}
+
+	return value.{{ .PkeyCol.GoName }}, nil
+}
+
+// Insert the given records, fill in their primary keys, then recursivly insert
+// the children attached to them which are mentioned in the include spec. Only
+// references from child records are followed. The records which parent and
+// many-to-many references point to must already exist, so they are left alone.
+// 'opts' only apply to 'recs' since options like InsertDefaultFields are
+// specific to a table.
+func (p *pgClientImpl) bulkInsert{{ .GoName }}Graph(
+	ctx context.Context,
+	recs []*{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.InsertOpt,
+) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	values := make([]{{ .GoName }}, 0, len(recs))
+	for _, rec := range recs {
+		values = append(values, *rec)
+	}
+	ids, err := p.bulkInsert{{ .GoName }}(ctx, values, opts...)
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(recs) {
+		return p.client.errorConverter(fmt.Errorf(
+			"inserting {{ .GoName }} graph: %d ids (expected %d)", len(ids), len(recs)))
+	}
+	for i, rec := range recs {
+		rec.{{ .PkeyCol.GoName }} = ids[i]
+	}
+
+	{{- range .Meta.AllIncomingReferences }}
+
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `]; inIncludeSet {
+		// point all the children at their newly inserted parents
+		children := make([]*{{ .PointsFrom.Info.GoName }}, 0, len(recs))
+		for _, rec := range recs {
+			{{- if .OneToOne }}
+			childRecs := []*{{ .PointsFrom.Info.GoName }}{rec.{{ .GoPointsFromFieldName }}}
+			{{- else }}
+			childRecs := rec.{{ .GoPointsFromFieldName }}
+			{{- end }}
+			for _, child := range childRecs {
+				if child == nil {
+					continue
+				}
+				{{- if (and .PointsFromField.Nullable .PointsToField.Nullable) }}
+				child.{{ .PointsFromField.GoName }} = rec.{{ .PointsToField.GoName }}
+				{{- else if .PointsFromField.Nullable }}
+				parentKey := rec.{{ .PointsToField.GoName }}
+				child.{{ .PointsFromField.GoName }} = &parentKey
+				{{- else if .PointsToField.Nullable }}
+				if rec.{{ .PointsToField.GoName }} == nil {
+					return p.client.errorConverter(fmt.Errorf(
+						` + "`" + `inserting {{ $.GoName }} graph: null '{{ .PointsToField.PgName }}' referenced by '{{ .PointsFrom.Info.PgName }}'` + "`" + `))
+				}
+				child.{{ .PointsFromField.GoName }} = *rec.{{ .PointsToField.GoName }}
+				{{- else }}
+				child.{{ .PointsFromField.GoName }} = rec.{{ .PointsToField.GoName }}
+				{{- end }}
+				children = append(children, child)
+			}
+		}
+
+		err = p.bulkInsert{{ .PointsFrom.Info.GoName }}Graph(ctx, children, subSpec)
+		if err != nil {
+			return err
+		}
+	}
+	{{- end }}
+
+	return nil
+}
+
 // bit indicies for 'fieldMask' parameters
 const (
 	{{- range $i, $c := .Meta.Info.Cols }}
@@ -418,6 +843,13 @@ var defaultableColsFor{{ .GoName }} = func() pggen.FieldSet {
 	return fs
 }()
 
+// named predicates for use with the 'where' include spec modifier
+var includePredicatesFor{{ .GoName }} = map[string]string{
+	{{- range .Meta.Config.IncludePredicates }}
+	` + "`" + `{{ .Name }}` + "`" + `: ` + "`" + `{{ .Sql }}` + "`" + `,
+	{{- end }}
+}
+
 var fieldsFor{{ .GoName }} []fieldNameAndIdx = []fieldNameAndIdx{
 	{{- range .Meta.Info.Cols }}
 	{ name: ` + "`" + `{{ .PgName }}` + "`" + `, idx: {{ $.GoName }}{{ .GoName }}FieldIndex },
@@ -469,6 +901,15 @@ func (p *pgClientImpl) update{{ .GoName }}(
 	fieldMask pggen.FieldSet,
 	opts ...pggen.UpdateOpt,
 ) (ret {{ .PkeyCol.TypeInfo.Name }}, err error) {
+	{{- if .Meta.Config.Audit }}
+	if !auditActorSet(ctx) {
+		err = p.withAuditActor(ctx, func(ctx context.Context, txImpl *pgClientImpl) (err error) {
+			ret, err = txImpl.update{{ .GoName }}(ctx, value, fieldMask, opts...)
+			return
+		})
+		return
+	}
+	{{- end }}
 	opt := pggen.UpdateOptions{}
 	for _, o := range opts {
 		o(&opt)
@@ -524,6 +965,12 @@ func (p *pgClientImpl) update{{ .GoName }}(
 		return ret, p.client.errorConverter(err)
 	}
 
+	p.emitChange(ctx, pggen.ChangeEvent{
+		Table: ` + "`" + `{{ .Meta.Info.PgRelName }}` + "`" + `,
+		Op:    pggen.ChangeUpdate,
+		IDs:   []{{ .PkeyCol.TypeInfo.Name }}{id},
+	})
+
 	return id, nil
 }
 
@@ -644,6 +1091,16 @@ func (p *pgClientImpl) bulkUpsert{{ .GoName }}(
 	fieldMask pggen.FieldSet,
 	opts ...pggen.UpsertOpt,
 ) ([]{{ .PkeyCol.TypeInfo.Name }}, error) {
+	{{- if .Meta.Config.Audit }}
+	if !auditActorSet(ctx) {
+		var ret []{{ .PkeyCol.TypeInfo.Name }}
+		err := p.withAuditActor(ctx, func(ctx context.Context, txImpl *pgClientImpl) (err error) {
+			ret, err = txImpl.bulkUpsert{{ .GoName }}(ctx, values, constraintNames, fieldMask, opts...)
+			return
+		})
+		return ret, err
+	}
+	{{- end }}
 	if len(values) == 0 {
 		return []{{ .PkeyCol.TypeInfo.Name }}{}, nil
 	}
@@ -792,6 +1249,12 @@ func (p *pgClientImpl) bulkUpsert{{ .GoName }}(
 		ids = append(ids, id)
 	}
 
+	p.emitChange(ctx, pggen.ChangeEvent{
+		Table: ` + "`" + `{{ .Meta.Info.PgRelName }}` + "`" + `,
+		Op:    pggen.ChangeUpsert,
+		IDs:   ids,
+	})
+
 	return ids, nil
 }
 
@@ -843,6 +1306,13 @@ func (p *pgClientImpl) bulkDelete{{ .GoName }}(
 	ids []{{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.DeleteOpt,
 ) error {
+	{{- if .Meta.Config.Audit }}
+	if !auditActorSet(ctx) {
+		return p.withAuditActor(ctx, func(ctx context.Context, txImpl *pgClientImpl) error {
+			return txImpl.bulkDelete{{ .GoName }}(ctx, ids, opts...)
+		})
+	}
+	{{- end }}
 	if len(ids) == 0 {
 		return nil
 	}
@@ -852,6 +1322,33 @@ func (p *pgClientImpl) bulkDelete{{ .GoName }}(
 		o(&options)
 	}
 
+	if options.Cascade != nil {
+		cascade := options.Cascade
+		err := Validate{{ .GoName }}Includes(cascade)
+		if err != nil {
+			return p.client.errorConverter(err)
+		}
+
+		var parentOpts []pggen.DeleteOpt
+		if options.DoHardDelete {
+			parentOpts = append(parentOpts, pggen.DeleteDoHardDelete)
+		}
+		{{- if .Meta.HasDeletedAtField }}
+		hardDelete := options.DoHardDelete
+		{{- else }}
+		// {{ .PgName }} has no deleted at field, so it is always hard deleted
+		hardDelete := true
+		{{- end }}
+		return p.runInTx(ctx, func(txImpl *pgClientImpl) error {
+			// delete the children first so that hard deletes don't trip over foreign keys
+			err := txImpl.deleteChildrenOf{{ .GoName }}(ctx, ids, cascade, hardDelete)
+			if err != nil {
+				return err
+			}
+			return txImpl.bulkDelete{{ .GoName }}(ctx, ids, parentOpts...)
+		})
+	}
+
 	{{- if .Meta.HasDeletedAtField }}
 	{{- if .Meta.DeletedAtHasTimezone }}
 	now := time.Now()
@@ -900,20 +1397,277 @@ func (p *pgClientImpl) bulkDelete{{ .GoName }}(
 		))
 	}
 
-	return err
+	p.emitChange(ctx, pggen.ChangeEvent{
+		Table: ` + "`" + `{{ .Meta.Info.PgRelName }}` + "`" + `,
+		Op:    pggen.ChangeDelete,
+		IDs:   ids,
+	})
+
+	return nil
+}
+
+// deleteChildrenOf{{ .GoName }} deletes the children of the given records mentioned
+// in the include spec, recursing through the whole spec. hardDelete indicates
+// that the given records are being hard deleted, in which case all of their
+// children, including ones which were already soft deleted, get hard deleted
+// as well. It must be called within a transaction.
+func (p *pgClientImpl) deleteChildrenOf{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	cascade *include.Spec,
+	hardDelete bool,
+) error {
+	if len(ids) == 0 {
+		// cyclic specs only terminate once we run out of records
+		return nil
+	}
+
+	for name := range cascade.Includes {
+		switch name {
+		{{- range .Meta.AllIncomingReferences }}
+		case ` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `:
+		{{- end }}
+		default:
+			return p.client.errorConverter(fmt.Errorf(
+				` + "`" + `DeleteCascade: '%s' is not a reference from child records of '{{ .PgName }}'` + "`" + `,
+				name,
+			))
+		}
+	}
+
+	{{- if .Meta.AllIncomingReferences }}
+
+	var deleteOpts []pggen.DeleteOpt
+	if hardDelete {
+		deleteOpts = append(deleteOpts, pggen.DeleteDoHardDelete)
+	}
+	{{- end }}
+
+	{{- range .Meta.AllIncomingReferences }}
+
+	if subSpec, inIncludeSet := cascade.Includes[` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `]; inIncludeSet {
+		query := ` + "`" + `SELECT c."{{ .PointsFrom.Info.PkeyCol.PgName }}"
+			FROM {{ .PointsFrom.Info.PgName }} c
+			JOIN {{ $.PgName }} p ON (c."{{ .PointsFromField.PgName }}" = p."{{ .PointsToField.PgName }}")
+			WHERE p."{{ $.PkeyCol.PgName }}" = ANY($1)` + "`" + `
+		{{- if .PointsFrom.HasDeletedAtField }}
+		if !hardDelete {
+			// leave the deleted_at timestamps of children which were already deleted alone
+			query += ` + "`" + ` AND c."{{ .PointsFrom.PgDeletedAtField }}" IS NULL` + "`" + `
+		}
+		{{- end }}
+
+		rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
+		if err != nil {
+			return p.client.errorConverter(err)
+		}
+		var childIDs []{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}
+		for rows.Next() {
+			var childID {{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}
+			err = rows.Scan({{ call .PointsFrom.Info.PkeyCol.TypeInfo.SqlReceiver "childID" }})
+			if err != nil {
+				_ = rows.Close()
+				return p.client.errorConverter(err)
+			}
+			childIDs = append(childIDs, childID)
+		}
+		err = rows.Close()
+		if err != nil {
+			return p.client.errorConverter(err)
+		}
+
+		{{- if .PointsFrom.HasDeletedAtField }}
+		err = p.deleteChildrenOf{{ .PointsFrom.Info.GoName }}(ctx, childIDs, subSpec, hardDelete)
+		{{- else }}
+		// {{ .PointsFrom.Info.PgName }} has no deleted at field, so it is always hard deleted
+		err = p.deleteChildrenOf{{ .PointsFrom.Info.GoName }}(ctx, childIDs, subSpec, true)
+		{{- end }}
+		if err != nil {
+			return err
+		}
+		err = p.bulkDelete{{ .PointsFrom.Info.GoName }}(ctx, childIDs, deleteOpts...)
+		if err != nil {
+			return err
+		}
+	}
+	{{- end }}
+
+	return nil
+}
+{{- if .Meta.HasDeletedAtField }}
+
+// Restore{{ .GoName }} undoes a soft delete of the {{ .GoName }} with the given id
+// by clearing its deleted at timestamp. Restoring a record which has not been
+// deleted is a not found error.
+func (p *PGClient) Restore{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return p.impl.bulkRestore{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id})
+}
+func (tx *TxPGClient) Restore{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return tx.impl.bulkRestore{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id})
+}
+func (conn *ConnPGClient) Restore{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return conn.impl.bulkRestore{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id})
+}
+
+func (p *PGClient) BulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return p.impl.bulkRestore{{ .GoName }}(ctx, ids)
+}
+func (tx *TxPGClient) BulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return tx.impl.bulkRestore{{ .GoName }}(ctx, ids)
+}
+func (conn *ConnPGClient) BulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return conn.impl.bulkRestore{{ .GoName }}(ctx, ids)
 }
+func (p *pgClientImpl) bulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	{{- if .Meta.Config.Audit }}
+	if !auditActorSet(ctx) {
+		return p.withAuditActor(ctx, func(ctx context.Context, txImpl *pgClientImpl) error {
+			return txImpl.bulkRestore{{ .GoName }}(ctx, ids)
+		})
+	}
+	{{- end }}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res, err := p.db.ExecContext(
+		ctx,
+		` + "`" + `UPDATE {{ .PgName }} SET "{{ .Meta.PgDeletedAtField }}" = NULL
+		WHERE "{{ .PkeyCol.PgName }}" = ANY($1) AND "{{ .Meta.PgDeletedAtField }}" IS NOT NULL` + "`" + `,
+		pgtypes.Array(ids),
+	)
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+
+	nrows, err := res.RowsAffected()
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+
+	if nrows != int64(len(ids)) {
+		return p.client.errorConverter(&unstable.NotFoundError{
+			Msg: fmt.Sprintf(
+				"BulkRestore{{ .GoName }}: %d rows restored, expected %d",
+				nrows,
+				len(ids),
+			),
+		})
+	}
+
+	p.emitChange(ctx, pggen.ChangeEvent{
+		Table: ` + "`" + `{{ .Meta.Info.PgRelName }}` + "`" + `,
+		Op:    pggen.ChangeUpdate,
+		IDs:   ids,
+	})
+
+	return nil
+}
+
+// PurgeDeleted{{ .GoName }} hard deletes every {{ .GoName }} which was soft deleted
+// before the given time, returning the number of records purged.
+func (p *PGClient) PurgeDeleted{{ .GoName }}(
+	ctx context.Context,
+	olderThan time.Time,
+) (int64, error) {
+	return p.impl.purgeDeleted{{ .GoName }}(ctx, olderThan)
+}
+func (tx *TxPGClient) PurgeDeleted{{ .GoName }}(
+	ctx context.Context,
+	olderThan time.Time,
+) (int64, error) {
+	return tx.impl.purgeDeleted{{ .GoName }}(ctx, olderThan)
+}
+func (conn *ConnPGClient) PurgeDeleted{{ .GoName }}(
+	ctx context.Context,
+	olderThan time.Time,
+) (int64, error) {
+	return conn.impl.purgeDeleted{{ .GoName }}(ctx, olderThan)
+}
+func (p *pgClientImpl) purgeDeleted{{ .GoName }}(
+	ctx context.Context,
+	olderThan time.Time,
+) (int64, error) {
+	{{- if .Meta.Config.Audit }}
+	if !auditActorSet(ctx) {
+		var nrows int64
+		err := p.withAuditActor(ctx, func(ctx context.Context, txImpl *pgClientImpl) (err error) {
+			nrows, err = txImpl.purgeDeleted{{ .GoName }}(ctx, olderThan)
+			return
+		})
+		return nrows, err
+	}
+	{{- end }}
+	{{- if (not .Meta.DeletedAtHasTimezone) }}
+	// deleted at timestamps are stored in UTC
+	olderThan = olderThan.UTC()
+	{{- end }}
+	res, err := p.db.ExecContext(
+		ctx,
+		` + "`" + `DELETE FROM {{ .PgName }} WHERE "{{ .Meta.PgDeletedAtField }}" < $1` + "`" + `,
+		olderThan,
+	)
+	if err != nil {
+		return 0, p.client.errorConverter(err)
+	}
+
+	nrows, err := res.RowsAffected()
+	if err != nil {
+		return 0, p.client.errorConverter(err)
+	}
+
+	return nrows, nil
+}
+{{- end }}
+
+{{- if .Meta.Info.Constraints }}
+
+// The names of the constraints on the {{ .PgName }} table
+const (
+	{{- range .Meta.Info.Constraints }}
+	{{ $.GoName }}{{ .GoName }}Constraint = ` + "`" + `{{ .PgName }}` + "`" + `
+	{{- end }}
+)
+{{- end }}
 
 var {{ .GoName }}AllIncludes *include.Spec = include.Must(include.Parse(
 	` + "`" + `{{ .AllIncludeSpec }}` + "`" + `,
 ))
 
+// Validate{{ .GoName }}Includes checks that every edge in the given include spec
+// refers to a relationship of the '{{ .PgName }}' table that pggen knows about.
+func Validate{{ .GoName }}Includes(includes *include.Spec) error {
+	return includeGraph.Validate(` + "`" + `{{ .PgName }}` + "`" + `, includes)
+}
+
 func (p *PGClient) {{ .GoName }}FillIncludes(
 	ctx context.Context,
 	rec *{{ .GoName }},
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	return p.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes)
+	return p.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes, opts...)
 }
 func (tx *TxPGClient) {{ .GoName }}FillIncludes(
 	ctx context.Context,
@@ -921,7 +1675,7 @@ func (tx *TxPGClient) {{ .GoName }}FillIncludes(
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	return tx.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes)
+	return tx.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes, opts...)
 }
 func (conn *ConnPGClient) {{ .GoName }}FillIncludes(
 	ctx context.Context,
@@ -929,7 +1683,7 @@ func (conn *ConnPGClient) {{ .GoName }}FillIncludes(
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	return conn.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes)
+	return conn.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes, opts...)
 }
 
 func (p *PGClient) {{ .GoName }}BulkFillIncludes(
@@ -938,7 +1692,7 @@ func (p *PGClient) {{ .GoName }}BulkFillIncludes(
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	return p.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes)
+	return p.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opts...)
 }
 func (tx *TxPGClient) {{ .GoName }}BulkFillIncludes(
 	ctx context.Context,
@@ -946,7 +1700,7 @@ func (tx *TxPGClient) {{ .GoName }}BulkFillIncludes(
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	return tx.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes)
+	return tx.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opts...)
 }
 func (conn *ConnPGClient) {{ .GoName }}BulkFillIncludes(
 	ctx context.Context,
@@ -954,7 +1708,7 @@ func (conn *ConnPGClient) {{ .GoName }}BulkFillIncludes(
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	return conn.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes)
+	return conn.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opts...)
 }
 func (p *pgClientImpl) private{{ .GoName }}BulkFillIncludes(
 	ctx context.Context,
@@ -962,7 +1716,14 @@ func (p *pgClientImpl) private{{ .GoName }}BulkFillIncludes(
 	includes *include.Spec,
 	opts ...pggen.IncludeOpt,
 ) error {
-	loadedRecordTab := map[string]interface{}{}
+	err := Validate{{ .GoName }}Includes(includes)
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+
+	// a no-op if 'p' has already been pointed at a replica
+	p = p.forRead(ctx)
+	loadedRecordTab := newLoadedRecordTable(p.db, opts)
 
 	return p.impl{{ .GoName }}BulkFillIncludes(ctx, recs, includes, loadedRecordTab)
 }
@@ -971,7 +1732,7 @@ func (p *pgClientImpl) impl{{ .GoName }}BulkFillIncludes(
 	ctx context.Context,
 	recs []*{{ .GoName }},
 	includes *include.Spec,
-	loadedRecordTab map[string]interface{},
+	loadedRecordTab *loadedRecordTable,
 ) (err error) {
 	if includes.TableName != ` + "`" + `{{ .PgName }}` + "`" + ` {
 		return p.client.errorConverter(fmt.Errorf(
@@ -980,7 +1741,8 @@ func (p *pgClientImpl) impl{{ .GoName }}BulkFillIncludes(
 		))
 	}
 
-	loadedTab, inMap := loadedRecordTab[` + "`" + `{{ .PgName }}` + "`" + `]
+	loadedRecordTab.mu.Lock()
+	loadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PgName }}` + "`" + `]
 	if inMap {
 		idToRecord := loadedTab.(map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }})
 		for _, r := range recs {
@@ -994,67 +1756,104 @@ func (p *pgClientImpl) impl{{ .GoName }}BulkFillIncludes(
 		for _, r := range recs {
 			idToRecord[r.{{ .PkeyCol.GoName }}] = r
 		}
-		loadedRecordTab[` + "`" + `{{ .PgName }}` + "`" + `] = idToRecord
+		loadedRecordTab.tabs[` + "`" + `{{ .PgName }}` + "`" + `] = idToRecord
 	}
+	loadedRecordTab.mu.Unlock()
+
+	{{- if (or .Meta.AllIncomingReferences .Meta.AllOutgoingReferences .Meta.AllThroughReferences) }}
 
-	{{- if (or .Meta.AllIncomingReferences .Meta.AllOutgoingReferences) }}
-	var subSpec *include.Spec
-	var inIncludeSet bool
+	// each branch fills in one child of the include spec. Branches only share
+	// the loaded record table, so they may be run in parallel.
+	branches := make([]func() error, 0, len(includes.Includes))
 	{{- end }}
 
 	{{- range .Meta.AllIncomingReferences }}
 	// Fill in the {{ .PointsFrom.Info.PluralGoName }} if it is in includes
-	subSpec, inIncludeSet = includes.Includes[` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `]
-	if inIncludeSet {
-		err = p.private{{ $.GoName }}Fill{{ .GoPointsFromFieldName }}(ctx, loadedRecordTab)
-		if err != nil {
-			return p.client.errorConverter(err)
-		}
-
-		subRecs := make([]*{{ .PointsFrom.Info.GoName }}, 0, len(recs))
-		for _, outer := range recs {
-			{{- if .OneToOne }}
-			if outer.{{ .GoPointsFromFieldName }} != nil {
-				subRecs = append(subRecs, outer.{{ .GoPointsFromFieldName }})
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `]; inIncludeSet {
+		branches = append(branches, func() error {
+			err := p.private{{ $.GoName }}Fill{{ .GoPointsFromFieldName }}(ctx, loadedRecordTab, subSpec.Modifiers)
+			if err != nil {
+				return err
 			}
-			{{- else }}
-			for i := range outer.{{ .GoPointsFromFieldName }} {
-				{{- if .Nullable }}
-				if outer.{{ .GoPointsFromFieldName }}[i] == nil {
-					continue
+
+			loadedRecordTab.mu.Lock()
+			subRecs := make([]*{{ .PointsFrom.Info.GoName }}, 0, len(recs))
+			for _, outer := range recs {
+				{{- if .OneToOne }}
+				if outer.{{ .GoPointsFromFieldName }} != nil {
+					subRecs = append(subRecs, outer.{{ .GoPointsFromFieldName }})
+				}
+				{{- else }}
+				for i := range outer.{{ .GoPointsFromFieldName }} {
+					{{- if .Nullable }}
+					if outer.{{ .GoPointsFromFieldName }}[i] == nil {
+						continue
+					}
+					{{- end }}
+					subRecs = append(subRecs, outer.{{ .GoPointsFromFieldName }}[i])
 				}
 				{{- end }}
-				subRecs = append(subRecs, outer.{{ .GoPointsFromFieldName }}[i])
 			}
-			{{- end }}
-		}
+			loadedRecordTab.mu.Unlock()
 
-		err = p.impl{{ .PointsFrom.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, loadedRecordTab)
-		if err != nil {
-			return p.client.errorConverter(err)
-		}
+			return p.impl{{ .PointsFrom.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, loadedRecordTab)
+		})
 	}
 	{{- end }}
 
 	{{- range .Meta.AllOutgoingReferences }}
-	subSpec, inIncludeSet = includes.Includes[` + "`" + `{{ .PgPointsToFieldName }}` + "`" + `]
-	if inIncludeSet {
-		err = p.private{{ $.GoName }}FillParent{{ .GoPointsToFieldName }}(ctx, loadedRecordTab)
-		if err != nil {
-			return p.client.errorConverter(err)
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgPointsToFieldName }}` + "`" + `]; inIncludeSet {
+		if subSpec.Modifiers != nil {
+			return p.client.errorConverter(fmt.Errorf(
+				` + "`" + `include spec: modifiers are not supported for references to parent records ('{{ .PgPointsToFieldName }}')` + "`" + `,
+			))
 		}
+		branches = append(branches, func() error {
+			err := p.private{{ $.GoName }}FillParent{{ .GoPointsToFieldName }}(ctx, loadedRecordTab)
+			if err != nil {
+				return err
+			}
 
-		subRecs := make([]*{{ .PointsTo.Info.GoName }}, 0, len(recs))
-		for _, outer := range recs {
-			if outer.{{ .GoPointsToFieldName }} != nil {
-				subRecs = append(subRecs, outer.{{ .GoPointsToFieldName }})
+			loadedRecordTab.mu.Lock()
+			subRecs := make([]*{{ .PointsTo.Info.GoName }}, 0, len(recs))
+			for _, outer := range recs {
+				if outer.{{ .GoPointsToFieldName }} != nil {
+					subRecs = append(subRecs, outer.{{ .GoPointsToFieldName }})
+				}
 			}
-		}
+			loadedRecordTab.mu.Unlock()
 
-		err = p.impl{{ .PointsTo.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, loadedRecordTab)
-		if err != nil {
-			return p.client.errorConverter(err)
-		}
+			return p.impl{{ .PointsTo.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, loadedRecordTab)
+		})
+	}
+	{{- end }}
+
+	{{- range .Meta.AllThroughReferences }}
+	// Fill in the {{ .GoFieldName }} if it is in includes
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgFieldName }}` + "`" + `]; inIncludeSet {
+		branches = append(branches, func() error {
+			err := p.private{{ $.GoName }}FillThrough{{ .GoFieldName }}(ctx, loadedRecordTab, subSpec.Modifiers)
+			if err != nil {
+				return err
+			}
+
+			loadedRecordTab.mu.Lock()
+			subRecs := make([]*{{ .PointsTo.Info.GoName }}, 0, len(recs))
+			for _, outer := range recs {
+				subRecs = append(subRecs, outer.{{ .GoFieldName }}...)
+			}
+			loadedRecordTab.mu.Unlock()
+
+			return p.impl{{ .PointsTo.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, loadedRecordTab)
+		})
+	}
+	{{- end }}
+
+	{{- if (or .Meta.AllIncomingReferences .Meta.AllOutgoingReferences .Meta.AllThroughReferences) }}
+
+	err = loadedRecordTab.fillBranches(branches)
+	if err != nil {
+		return p.client.errorConverter(err)
 	}
 	{{- end }}
 
@@ -1067,10 +1866,13 @@ func (p *pgClientImpl) impl{{ .GoName }}BulkFillIncludes(
 // connected to them using a single query.
 func (p *pgClientImpl) private{{ $.GoName }}Fill{{ .GoPointsFromFieldName }}(
 	ctx context.Context,
-	loadedRecordTab map[string]interface{},
+	loadedRecordTab *loadedRecordTable,
+	mods *include.Modifiers,
 ) error {
-	parentLoadedTab, inMap := loadedRecordTab[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `]
+	loadedRecordTab.mu.Lock()
+	parentLoadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `]
 	if !inMap {
+		loadedRecordTab.mu.Unlock()
 		return fmt.Errorf("internal pggen error: table not pre-loaded")
 	}
 	parentIDToRecord := parentLoadedTab.(map[{{ .PointsToField.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }})
@@ -1078,50 +1880,83 @@ func (p *pgClientImpl) private{{ $.GoName }}Fill{{ .GoPointsFromFieldName }}(
 	for _, rec := range parentIDToRecord {
 		ids = append(ids, rec.{{ .PointsToField.GoName }})
 	}
+	loadedRecordTab.mu.Unlock()
 
-	var childIDToRecord map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }}
-	childLoadedTab, inMap := loadedRecordTab[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `]
-	if inMap {
-		childIDToRecord = childLoadedTab.(map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }})
-	} else {
-		childIDToRecord = map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }}{}
+	query := ` + "`" +
+	`SELECT * FROM {{ .PointsFrom.Info.PgName }}
+		 WHERE "{{ .PointsFromField.PgName }}" = ANY($1)` +
+	"`" + `
+	{{- if .PointsFrom.HasDeletedAtField }}
+	if !loadedRecordTab.includeDeleted {
+		query += ` + "`" + ` AND "{{ .PointsFrom.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+	if mods != nil {
+		whereClause := ` + "`" + `WHERE pggen_child."{{ .PointsFromField.PgName }}" = pggen_parents.pggen_parent_id` + "`" + `
+		{{- if .PointsFrom.HasDeletedAtField }}
+		if !loadedRecordTab.includeDeleted {
+			whereClause += ` + "`" + ` AND pggen_child."{{ .PointsFrom.PgDeletedAtField }}" IS NULL` + "`" + `
+		}
+		{{- end }}
+		modifiedQuery, err := genModifiedFillQuery(
+			` + "`" + `{{ .PointsToField.PgType }}` + "`" + `,
+			` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `,
+			` + "`" + `pggen_child.*` + "`" + `,
+			whereClause,
+			genTimeColIdxTabFor{{ .PointsFrom.Info.GoName }},
+			includePredicatesFor{{ .PointsFrom.Info.GoName }},
+			mods,
+		)
+		if err != nil {
+			return p.client.errorConverter(err)
+		}
+		query = modifiedQuery
 	}
 
-	rows, err := p.queryContext(
-		ctx,
-		` + "`" +
-	`SELECT * FROM {{ .PointsFrom.Info.PgName }}
-		 WHERE "{{ .PointsFromField.PgName }}" = ANY($1)
-		 {{- if .PointsFrom.HasDeletedAtField }} AND "{{ .PointsFrom.PgDeletedAtField }}" IS NULL {{- end }}
-		 ` +
-	"`" + `,
-		pgtypes.Array(ids),
-	)
+	loadedRecordTab.acquireQuerySlot()
+	defer loadedRecordTab.releaseQuerySlot()
+
+	rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
 	if err != nil {
 		return p.client.errorConverter(err)
 	}
 	defer rows.Close()
 
-	// pull all the child records from the database and associate them with
-	// the correct parent.
+	// pull all the child records from the database before taking the lock
+	var scannedChildRecs []*{{ .PointsFrom.Info.GoName }}
 	for rows.Next() {
 		var scannedChildRec {{ .PointsFrom.Info.GoName }}
 		err = scannedChildRec.Scan(ctx, p.client, rows)
 		if err != nil {
 			return p.client.errorConverter(err)
 		}
+		scannedChildRecs = append(scannedChildRecs, &scannedChildRec)
+	}
+
+	loadedRecordTab.mu.Lock()
+	defer loadedRecordTab.mu.Unlock()
+
+	var childIDToRecord map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }}
+	childLoadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `]
+	if inMap {
+		childIDToRecord = childLoadedTab.(map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }})
+	} else {
+		childIDToRecord = map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }}{}
+	}
 
+	// associate the child records with the correct parent.
+	for _, scannedChildRec := range scannedChildRecs {
 		var childRec *{{ .PointsFrom.Info.GoName }}
 
 		preloadedChildRec, alreadyLoaded := childIDToRecord[scannedChildRec.{{ .PointsFrom.Info.PkeyCol.GoName }}]
 		if alreadyLoaded {
 			childRec = preloadedChildRec
 		} else {
-			childRec = &scannedChildRec
+			childRec = scannedChildRec
 			{{- if .PointsFrom.Info.PkeyCol.Nullable }}
-			childIDToRecord[*scannedChildRec.{{ .PointsFrom.Info.PkeyCol.GoName }}] = &scannedChildRec
+			childIDToRecord[*scannedChildRec.{{ .PointsFrom.Info.PkeyCol.GoName }}] = scannedChildRec
 			{{- else }}
-			childIDToRecord[scannedChildRec.{{ .PointsFrom.Info.PkeyCol.GoName }}] = &scannedChildRec
+			childIDToRecord[scannedChildRec.{{ .PointsFrom.Info.PkeyCol.GoName }}] = scannedChildRec
 			{{- end }}
 		}
 
@@ -1139,7 +1974,7 @@ func (p *pgClientImpl) private{{ $.GoName }}Fill{{ .GoPointsFromFieldName }}(
 		{{- end }}
 	}
 
-	loadedRecordTab[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `] = childIDToRecord
+	loadedRecordTab.tabs[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `] = childIDToRecord
 
 	return nil
 }
@@ -1151,10 +1986,13 @@ func (p *pgClientImpl) private{{ $.GoName }}Fill{{ .GoPointsFromFieldName }}(
 // connected to them using at most one query.
 func (p *pgClientImpl) private{{ $.GoName }}FillParent{{ .GoPointsToFieldName }}(
 	ctx context.Context,
-	loadedRecordTab map[string]interface{},
+	loadedRecordTab *loadedRecordTable,
 ) error {
+	loadedRecordTab.mu.Lock()
+	defer loadedRecordTab.mu.Unlock()
+
 	// lookup the table of child records
-	childLoadedTab, inMap := loadedRecordTab[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `]
+	childLoadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `]
 	if !inMap {
 		return p.client.errorConverter(fmt.Errorf("internal pggen error: table not pre-loaded"))
 	}
@@ -1162,11 +2000,12 @@ func (p *pgClientImpl) private{{ $.GoName }}FillParent{{ .GoPointsToFieldName }}
 
 	// lookup the table of parent records
 	var parentIDToRecord map[{{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }}
-	parentLoadedTab, inMap := loadedRecordTab[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `]
+	parentLoadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `]
 	if inMap {
 		parentIDToRecord = parentLoadedTab.(map[{{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }})
 	} else {
 		parentIDToRecord = map[{{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }}{}
+		loadedRecordTab.tabs[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `] = parentIDToRecord
 	}
 
 	// partition the parents into those records which we have already loaded and those
@@ -1212,38 +2051,185 @@ func (p *pgClientImpl) private{{ $.GoName }}FillParent{{ .GoPointsToFieldName }}
 		}
 	}
 
-	// fetch any outstanding parent records
-	if len(ids) > 0 {
-		rows, err := p.queryContext(
-			ctx,
-		` + "`" +
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// fetch any outstanding parent records. We must not hold the lock while
+	// waiting on the database.
+	loadedRecordTab.mu.Unlock()
+	parentRecs, err := p.private{{ $.GoName }}FetchParent{{ .GoPointsToFieldName }}(ctx, loadedRecordTab, ids)
+	loadedRecordTab.mu.Lock()
+	if err != nil {
+		return err
+	}
+
+	for _, parentRec := range parentRecs {
+		// another branch may have loaded the same record in the meantime
+		loadedParentRec, alreadyLoaded := parentIDToRecord[parentRec.{{ .PointsTo.Info.PkeyCol.GoName }}]
+		if alreadyLoaded {
+			parentRec = loadedParentRec
+		} else {
+			parentIDToRecord[parentRec.{{ .PointsTo.Info.PkeyCol.GoName }}] = parentRec
+		}
+
+		childRecs := parentIDToChildren[parentRec.{{ .PointsTo.Info.PkeyCol.GoName }}]
+		for _, childRec := range childRecs {
+			childRec.{{ .GoPointsToFieldName }} = parentRec
+		}
+	}
+
+	return nil
+}
+
+func (p *pgClientImpl) private{{ $.GoName }}FetchParent{{ .GoPointsToFieldName }}(
+	ctx context.Context,
+	loadedRecordTab *loadedRecordTable,
+	ids []{{ .PointsToField.TypeInfo.Name }},
+) ([]*{{ .PointsTo.Info.GoName }}, error) {
+	loadedRecordTab.acquireQuerySlot()
+	defer loadedRecordTab.releaseQuerySlot()
+
+	query := ` + "`" +
 	`SELECT * FROM {{ .PointsTo.Info.PgName }}
-			WHERE {{ .PointsToField.PgName }} = ANY($1)
-		 {{- if .PointsTo.HasDeletedAtField }} AND "{{ .PointsTo.PgDeletedAtField }}" IS NULL {{- end -}}
-		 ` + "`" + `,
-			pgtypes.Array(ids),
+		WHERE {{ .PointsToField.PgName }} = ANY($1)` + "`" + `
+	{{- if .PointsTo.HasDeletedAtField }}
+	if !loadedRecordTab.includeDeleted {
+		query += ` + "`" + ` AND "{{ .PointsTo.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+
+	rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
+	if err != nil {
+		return nil, p.client.errorConverter(err)
+	}
+	defer rows.Close()
+
+	var parentRecs []*{{ .PointsTo.Info.GoName }}
+	for rows.Next() {
+		var parentRec {{ .PointsTo.Info.GoName }}
+		err = parentRec.Scan(ctx, p.client, rows)
+		if err != nil {
+			return nil, p.client.errorConverter(fmt.Errorf("scanning parent record: %s", err.Error()))
+		}
+		parentRecs = append(parentRecs, &parentRec)
+	}
+
+	return parentRecs, nil
+}
+{{ end }}
+{{ range .Meta.AllThroughReferences }}
+
+// For a given set of {{ $.GoName }}, fill in all the {{ .PointsTo.Info.GoName }}
+// connected to them through {{ .PgJoinTable }} using a single query.
+func (p *pgClientImpl) private{{ $.GoName }}FillThrough{{ .GoFieldName }}(
+	ctx context.Context,
+	loadedRecordTab *loadedRecordTable,
+	mods *include.Modifiers,
+) error {
+	loadedRecordTab.mu.Lock()
+	ownerLoadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `]
+	if !inMap {
+		loadedRecordTab.mu.Unlock()
+		return fmt.Errorf("internal pggen error: table not pre-loaded")
+	}
+	ownerIDToRecord := ownerLoadedTab.(map[{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsFrom.Info.GoName }})
+	ids := make([]{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}, 0, len(ownerIDToRecord))
+	for _, rec := range ownerIDToRecord {
+		ids = append(ids, rec.{{ .PointsFrom.Info.PkeyCol.GoName }})
+	}
+	loadedRecordTab.mu.Unlock()
+
+	query := ` + "`" +
+	`SELECT t.*, j."{{ .PgFromKeyField }}" AS pggen_through_key
+		 FROM {{ .PointsTo.Info.PgName }} t
+		 JOIN {{ .PgJoinTable }} j ON (j."{{ .PgToKeyField }}" = t."{{ .PointsTo.Info.PkeyCol.PgName }}")
+		 WHERE j."{{ .PgFromKeyField }}" = ANY($1)` +
+	"`" + `
+	{{- if .PointsTo.HasDeletedAtField }}
+	if !loadedRecordTab.includeDeleted {
+		query += ` + "`" + ` AND t."{{ .PointsTo.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+	if mods != nil {
+		whereClause := ` + "`" + `JOIN {{ .PgJoinTable }} j ON (j."{{ .PgToKeyField }}" = pggen_child."{{ .PointsTo.Info.PkeyCol.PgName }}")
+			WHERE j."{{ .PgFromKeyField }}" = pggen_parents.pggen_parent_id` + "`" + `
+		{{- if .PointsTo.HasDeletedAtField }}
+		if !loadedRecordTab.includeDeleted {
+			whereClause += ` + "`" + ` AND pggen_child."{{ .PointsTo.PgDeletedAtField }}" IS NULL` + "`" + `
+		}
+		{{- end }}
+		modifiedQuery, err := genModifiedFillQuery(
+			` + "`" + `{{ .PointsFrom.Info.PkeyCol.PgType }}` + "`" + `,
+			` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `,
+			` + "`" + `pggen_child.*, j."{{ .PgFromKeyField }}" AS pggen_through_key` + "`" + `,
+			whereClause,
+			genTimeColIdxTabFor{{ .PointsTo.Info.GoName }},
+			includePredicatesFor{{ .PointsTo.Info.GoName }},
+			mods,
 		)
 		if err != nil {
 			return p.client.errorConverter(err)
 		}
-		defer rows.Close()
+		query = modifiedQuery
+	}
 
-		for rows.Next() {
-			var parentRec {{ .PointsTo.Info.GoName }}
-			err = parentRec.Scan(ctx, p.client, rows)
-			if err != nil {
-				return p.client.errorConverter(fmt.Errorf("scanning parent record: %s", err.Error()))
-			}
+	loadedRecordTab.acquireQuerySlot()
+	defer loadedRecordTab.releaseQuerySlot()
 
-			childRecs := parentIDToChildren[parentRec.{{ .PointsTo.Info.PkeyCol.GoName }}]
-			for _, childRec := range childRecs {
-				childRec.{{ .GoPointsToFieldName }} = &parentRec
-			}
-			parentIDToRecord[parentRec.{{ .PointsTo.Info.PkeyCol.GoName }}] = &parentRec
+	rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return p.client.errorConverter(err)
+	}
+
+	// pull all the target records from the database before taking the lock
+	var (
+		scannedTargetRecs []*{{ .PointsTo.Info.GoName }}
+		ownerIDs []{{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}
+	)
+	for rows.Next() {
+		var (
+			scannedTargetRec {{ .PointsTo.Info.GoName }}
+			ownerID {{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}
+		)
+		err = scannedTargetRec.scanWithThroughKey(rows, cols, {{ call .PointsFrom.Info.PkeyCol.TypeInfo.SqlReceiver "ownerID" }})
+		if err != nil {
+			return p.client.errorConverter(err)
 		}
+		scannedTargetRecs = append(scannedTargetRecs, &scannedTargetRec)
+		ownerIDs = append(ownerIDs, ownerID)
+	}
+
+	loadedRecordTab.mu.Lock()
+	defer loadedRecordTab.mu.Unlock()
+
+	var targetIDToRecord map[{{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }}
+	targetLoadedTab, inMap := loadedRecordTab.tabs[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `]
+	if inMap {
+		targetIDToRecord = targetLoadedTab.(map[{{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }})
+	} else {
+		targetIDToRecord = map[{{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]*{{ .PointsTo.Info.GoName }}{}
+	}
+
+	// associate the target records with the correct owner.
+	for i, scannedTargetRec := range scannedTargetRecs {
+		targetRec, alreadyLoaded := targetIDToRecord[scannedTargetRec.{{ .PointsTo.Info.PkeyCol.GoName }}]
+		if !alreadyLoaded {
+			targetRec = scannedTargetRec
+			targetIDToRecord[scannedTargetRec.{{ .PointsTo.Info.PkeyCol.GoName }}] = targetRec
+		}
+
+		ownerRec := ownerIDToRecord[ownerIDs[i]]
+		ownerRec.{{ .GoFieldName }} = append(ownerRec.{{ .GoFieldName }}, targetRec)
 	}
 
-	loadedRecordTab[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `] = parentIDToRecord
+	loadedRecordTab.tabs[` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `] = targetIDToRecord
 
 	return nil
 }
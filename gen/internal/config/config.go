@@ -23,15 +23,28 @@ type DbConfig struct {
 	DeletedAtField string `toml:"deleted_at_field"`
 	// If true, it is an error for any [[query]] config block to be missing
 	// the `comment` field. Useful if you want to be strict about documentation.
-	RequireQueryComments bool           `toml:"require_query_comments"`
-	TypeOverrides        []TypeOverride `toml:"type_override"`
-	Queries              []QueryConfig  `toml:"query"`
-	Stmts                []StmtConfig   `toml:"statement"`
-	Tables               []TableConfig  `toml:"table"`
+	RequireQueryComments bool `toml:"require_query_comments"`
+	// If true, turn on `infer_nullability` for every [[query]] config block.
+	InferQueryNullability bool `toml:"infer_query_nullability"`
+	// The database interface that the generated client is built on, either
+	// "database/sql" (the default) or "pgx". With "pgx", `NewPGClient` accepts a
+	// `pggen.PgxConn` such as a `*pgxpool.Pool` and the generated code talks to
+	// it directly rather than going through the pgx database/sql driver.
+	Backend       string          `toml:"backend"`
+	TypeOverrides []TypeOverride  `toml:"type_override"`
+	Queries       []QueryConfig   `toml:"query"`
+	Stmts         []StmtConfig    `toml:"statement"`
+	Tables        []TableConfig   `toml:"table"`
+	Channels      []ChannelConfig `toml:"channel"`
 }
 
+const (
+	BackendDatabaseSQL = "database/sql"
+	BackendPgx         = "pgx"
+)
+
 // Queries registered in the config file represent arbitrary bits of
-// SQL, possibly parameterized by $N arguments. The generated code
+// SQL, possibly parameterized by $N or named arguments. The generated code
 // will use `sql.QueryContext` and marshal the results into a list of
 // rows returned.
 type QueryConfig struct {
@@ -41,21 +54,30 @@ type QueryConfig struct {
 	// A comment to place on the generated method so that IDEs can provide
 	// online documentation for the method.
 	Comment string `toml:"comment"`
-	// The actual text of the query.
+	// The actual text of the query. Arguments may either be positional
+	// (`$1`, `$2`, ...) or named (`@foo` or `pggen.arg(foo)`), but a single
+	// query cannot mix the two styles. Every use of the same name refers to
+	// the same argument.
 	Body string `toml:"body"`
 	// A string consisting of the runes '-' and 'n' to indicate the
 	// nullability of return columns. '-' indicates that the column is
 	// not nullable (NOT NULL), while 'n' indicates that it is nullable.
 	// These need to be specified manually because postgres does not expose
-	// a mechanism for infering the nullability of query results that I
-	// could discover. The flags string must be exactly as long as the
-	// result set is wide.
+	// a general mechanism for infering the nullability of query results
+	// (though see `infer_nullability`). The flags string must be exactly as
+	// long as the result set is wide.
 	NullFlags string `toml:"null_flags"`
 	// A long-form way of specifying the same thing as `NullFlags`. Only one
 	// of the two options should be provided. Any fields appearing in this list
 	// will be treated as not nullable, with all other fields being considered
 	// nullable as is the default.
 	NotNullFields []string `toml:"not_null_fields"`
+	// If true, pggen will trace each result column back to the table column
+	// it comes from and treat the result column as NOT NULL if the table column
+	// is NOT NULL. Queries containing outer joins or grouping sets are skipped
+	// because they can produce NULLs for NOT NULL table columns. `null_flags`
+	// and `not_null_fields` take precedence over the infered nullability.
+	InferNullability bool `toml:"infer_nullability"`
 	// The name that should be used for this query's return type.
 	// This is useful because it allows multiple queries to return
 	// values of the same type so that client code does not have to
@@ -67,7 +89,8 @@ type QueryConfig struct {
 	// This configuration option allows you to give useful names to the
 	// query arguments in the genrated code (normaly pggen will just make up
 	// names like `arg0`, `arg1` and so on). An example mapping is
-	// `"1:foo 2:bar 3:baz"`.
+	// `"1:foo 2:bar 3:baz"`. Named arguments in the body are usually more
+	// convenient, and `arg_names` cannot be combined with them.
 	ArgNames string `toml:"arg_names"`
 	// If true, this query is expected to return just one result row, so
 	// `pggen` will generate code that returns just a single result rather
@@ -81,32 +104,80 @@ type QueryConfig struct {
 	// a pointer type would just be annoying for client code, but sometimes you
 	// do actually want nullable arguments.
 	NullableArguments bool `toml:"nullable_arguments"`
+	// A list of argument names which should be passed as go slices rather
+	// than single values. A slice argument may be used either in an IN list
+	// like `id IN (@ids)`, which will be rewritten to `id = ANY(@ids)`, or
+	// as the right hand side of any other comparison, in which case it will
+	// be wrapped in `ANY`.
+	SliceArgs []string `toml:"slice_args"`
+	// A list of argument names which may be omitted by passing nil. Optional
+	// arguments must appear as the right hand side of a comparison with a
+	// column (like `name = @name` or `id IN (@ids)` for a slice argument),
+	// and the comparison is rewritten so that a nil argument drops the filter.
+	// Optional arguments are passed as pointers, except for slice arguments
+	// which are already nillable.
+	OptionalArgs []string `toml:"optional_args"`
+	// If true, pggen will generate a `<Name>Params` struct with a field for
+	// each argument and the shims for this query will accept a single value
+	// of that type rather than one parameter per argument. The field names
+	// come from `arg_names` or the named arguments in the body.
+	ArgsStruct bool `toml:"args_struct"`
 	// If true and the query returns a slice, the values will be boxed as a slice
 	// of pointers. Otherwise, it will be a slice of struct values.
 	BoxResults bool `toml:"box_results"`
+	// If true, the query does not modify the database, so a client created with
+	// `NewPGClientWithReplicas` may run it against a read replica.
+	ReadOnly bool `toml:"read_only"`
 }
 
 // Statements are like queries but they are executed for side effects
 // and therefore return `(sql.Result, error)` rather than a set of
 // rows. Statements should be used for INSERT, UPDATE, and DELETE
-// operations.
+// operations. Statements with a RETURNING clause return the rows
+// they produce along with the number of rows affected.
 type StmtConfig struct {
 	// The name that should be used to identify this statement in generated
 	// go code.
 	Name string `toml:"name"`
-	// The actual text of this statement.
+	// The actual text of this statement. Arguments may be positional or
+	// named, just like for queries.
 	Body string `toml:"body"`
 	// A mapping of argument numbers to names to generate for them.
 	// This configuration option allows you to give useful names to the
 	// query arguments in the genrated code (normaly pggen will just make up
 	// names like `arg0`, `arg1` and so on). An example mapping is
-	// `"1:foo 2:bar 3:baz"`.
+	// `"1:foo 2:bar 3:baz"`. Named arguments in the body are usually more
+	// convenient, and `arg_names` cannot be combined with them.
 	ArgNames string `toml:"arg_names"`
 	// If true, allow nullable types to be passed in as arguments to the statement.
 	// Normally, statement arguments are always non-null so making every argument
 	// a pointer type would just be annoying for client code, but sometimes you
 	// do actually want nullable arguments.
 	NullableArguments bool `toml:"nullable_arguments"`
+	// A list of argument names which should be passed as go slices. See
+	// the `slice_args` query option.
+	SliceArgs []string `toml:"slice_args"`
+	// A list of argument names which may be omitted by passing nil. See
+	// the `optional_args` query option.
+	OptionalArgs []string `toml:"optional_args"`
+	// If true, generate a `<Name>Params` struct for the arguments to this
+	// statement. See the `args_struct` query option.
+	ArgsStruct bool `toml:"args_struct"`
+	// The name that should be used for the rows returned by a statement with
+	// a RETURNING clause. Works just like the `return_type` query option.
+	// Statements without a RETURNING clause cannot have a return type.
+	ReturnType string `toml:"return_type"`
+	// If true, this statement has a RETURNING clause and is expected to return
+	// just one row, so the generated shim will return a single result rather
+	// than a slice.
+	SingleResult bool `toml:"single_result"`
+	// Null flags for the columns in the RETURNING clause. See the `null_flags`
+	// query option. Unlike for queries, pggen will infer the nullability of
+	// RETURNING columns which come straight from a table column, so these
+	// are rarely needed.
+	NullFlags string `toml:"null_flags"`
+	// A long-form way of specifying the same thing as `NullFlags`.
+	NotNullFields []string `toml:"not_null_fields"`
 	// A comment to place on the generated method so that IDEs can provide
 	// online documentation for the method.
 	Comment string `toml:"comment"`
@@ -120,6 +191,16 @@ type TableConfig struct {
 	NoInferBelongsTo bool `toml:"no_infer_belongs_to"`
 	// A list of tables that this table belongs to
 	BelongsTo []BelongsTo `toml:"belongs_to"`
+	// If true, pggen will not infer many-to-many relationships between this
+	// table and other tables based on join tables which consist of nothing
+	// but foreign keys to the two tables.
+	NoInferHasManyThrough bool `toml:"no_infer_has_many_through"`
+	// A list of many-to-many relationships that this table participates in
+	// by way of a join table.
+	HasManyThrough []HasManyThrough `toml:"has_many_through"`
+	// A list of named predicates which can be used to filter records of this
+	// table with the `where` modifier in an include spec.
+	IncludePredicates []IncludePredicate `toml:"include_predicate"`
 	// The timestamp to update in `Insert`. Overriddes global version.
 	CreatedAtField string `toml:"created_at_field"`
 	// The timestamp to update in `Update` and `Insert`.
@@ -137,6 +218,11 @@ type TableConfig struct {
 	// If true, queries that return sliced results will return a slice of pointers.
 	// Otherwise, it will be a slice of struct values.
 	BoxResults bool `toml:"box_results"`
+	// If true, keep a history of every change made to the table. pggen writes the
+	// SQL for a `<table>_history` table, along with the trigger which fills it, to
+	// `<table>_history.sql` next to the generated code, and generates a `History`
+	// method to read back the versions of a record.
+	Audit bool `toml:"audit"`
 }
 
 // An explicitly configured foreign key relationship which can be attached
@@ -157,6 +243,39 @@ type BelongsTo struct {
 	ChildFieldName string `toml:"child_field_name"`
 }
 
+// An explicitly configured many-to-many relationship which can be attached
+// to a table's config. The generated struct for the table gets a field
+// holding the records from `Table` that are connected to it by rows in the
+// `Through` join table.
+type HasManyThrough struct {
+	// The table at the far end of the relationship
+	Table string `toml:"table"`
+	// The join table which holds foreign keys to both this table and `Table`.
+	// The join table does not need to be configured with a `[[table]]` block.
+	Through string `toml:"through"`
+	// Optional. The name of the column in the join table which points to this
+	// table. Only required if it can't be determined from the foreign keys on
+	// the join table.
+	KeyField string `toml:"key_field"`
+	// Optional. The name of the column in the join table which points to `Table`.
+	// Only required if it can't be determined from the foreign keys on the
+	// join table.
+	TargetKeyField string `toml:"target_key_field"`
+	// Optional. The name to give the generated field. If not provided, this
+	// will be the plural of the name of the struct for `Table`.
+	FieldName string `toml:"field_name"`
+}
+
+// A named SQL predicate which can be referred to from the `where` modifier
+// of an include spec.
+type IncludePredicate struct {
+	// The name used to refer to the predicate from include specs
+	Name string `toml:"name"`
+	// A boolean SQL expression. It may refer to the columns of the table
+	// it is attached to by name.
+	Sql string `toml:"sql"`
+}
+
 // Custom annotations to attach to the field generated for a given
 // database column.
 type FieldTag struct {
@@ -175,6 +294,18 @@ type JsonType struct {
 	Pkg string `toml:"pkg"`
 }
 
+// A postgres LISTEN/NOTIFY channel to generate `Notify` and `Listen` methods for.
+// Payloads are serialized using the encoding/json package.
+type ChannelConfig struct {
+	// The name of the channel in postgres
+	Name string `toml:"name"`
+	// The name of the type, including package name, that payloads sent on the
+	// channel should be parsed into.
+	TypeName string `toml:"type_name"`
+	// The import string for the package in which the type lives. Should include quotes.
+	Pkg string `toml:"pkg"`
+}
+
 type TypeOverride struct {
 	// The name of the type in postgres
 	PgTypeName string `toml:"postgres_type_name"`
@@ -219,6 +350,15 @@ type TypeOverride struct {
 // Give a user provided configuration, runs some santity checks on the provided values
 // to try to provent users from encountering hard to diagnose issues down the line.
 func (c *DbConfig) Validate() error {
+	if c.Backend != BackendDatabaseSQL && c.Backend != BackendPgx {
+		return fmt.Errorf(
+			"unknown backend '%s', expected '%s' or '%s'",
+			c.Backend,
+			BackendDatabaseSQL,
+			BackendPgx,
+		)
+	}
+
 	for _, override := range c.TypeOverrides {
 		if len(override.Pkg) > 0 {
 			err := names.ValidateImportPath(override.Pkg)
@@ -250,6 +390,21 @@ func (c *DbConfig) Validate() error {
 		}
 	}
 
+	for _, channel := range c.Channels {
+		if len(channel.Name) == 0 {
+			return fmt.Errorf("channel: missing name")
+		}
+		if len(channel.TypeName) == 0 {
+			return fmt.Errorf("channel '%s': missing type_name", channel.Name)
+		}
+		if len(channel.Pkg) > 0 {
+			err := names.ValidateImportPath(channel.Pkg)
+			if err != nil {
+				return fmt.Errorf("channel '%s': %s", channel.Name, err.Error())
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -258,7 +413,13 @@ func (c *DbConfig) Validate() error {
 //
 // In particular we:
 //   - resolve timestamp overrides and inheritance
+//   - push the global nullability inference flag down to the queries
+//   - default the backend to database/sql
 func (c *DbConfig) Normalize() error {
+	if len(c.Backend) == 0 {
+		c.Backend = BackendDatabaseSQL
+	}
+
 	for i, tc := range c.Tables {
 		if len(tc.CreatedAtField) == 0 && len(c.CreatedAtField) > 0 {
 			c.Tables[i].CreatedAtField = c.CreatedAtField
@@ -273,5 +434,11 @@ func (c *DbConfig) Normalize() error {
 		}
 	}
 
+	if c.InferQueryNullability {
+		for i := range c.Queries {
+			c.Queries[i].InferNullability = true
+		}
+	}
+
 	return nil
 }
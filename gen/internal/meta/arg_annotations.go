@@ -0,0 +1,218 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// file: arg_annotations.go
+// This file contains the logic for rewriting the predicates which use
+// `slice_args` and `optional_args` into SQL that postgres can execute.
+
+// argAnnotation describes the way that a single query argument should be
+// rewritten.
+type argAnnotation struct {
+	// The 1-based index of the argument
+	idx int
+	// The postgres type of the argument as written in the original query
+	pgType string
+	// If true, the argument should be passed as an array and compared with `ANY`
+	slice bool
+	// If true, a NULL argument should cause the predicate using it to be dropped
+	optional bool
+}
+
+// rewriteAnnotatedArg rewrites every use of the argument described by `ann`
+// in the given query body.
+//
+// Slice arguments may be used either as `<lhs> IN (@arg)`, `<lhs> NOT IN (@arg)`
+// or as the right hand side of a comparison, in which case the argument is
+// wrapped in `ANY`. For example `id IN ($1)` becomes `id = ANY($1::bigint[])`.
+//
+// Optional arguments must be the right hand side of a comparison with a simple
+// left hand side like a column name. The whole comparison is rewritten so that
+// it is true when the argument is NULL. For example `name = $1` becomes
+// `($1::text IS NULL OR name = $1)`.
+func rewriteAnnotatedArg(body string, ann argAnnotation) (string, error) {
+	spans := placeholderSpans(body, ann.idx)
+	if len(spans) == 0 {
+		return "", fmt.Errorf("argument $%d is never used", ann.idx)
+	}
+
+	castType := ann.pgType
+	if ann.slice {
+		castType += "[]"
+	}
+	castArg := fmt.Sprintf("$%d::%s", ann.idx, castType)
+
+	// work backwards so that earlier spans remain valid as we rewrite later ones
+	for i := len(spans) - 1; i >= 0; i-- {
+		argStart, argEnd := spans[i][0], spans[i][1]
+
+		// the region [predStart, predEnd) gets replaced with `pred`
+		predStart, predEnd := argStart, argEnd
+		pred := body[argStart:argEnd]
+
+		if ann.slice {
+			inStart, inEnd, negated, isIn := inListAround(body, argStart, argEnd)
+			if isIn {
+				predStart, predEnd = inStart, inEnd
+				if negated {
+					pred = fmt.Sprintf("<> ALL(%s)", castArg)
+				} else {
+					pred = fmt.Sprintf("= ANY(%s)", castArg)
+				}
+			} else {
+				pred = fmt.Sprintf("ANY(%s)", castArg)
+			}
+		}
+
+		if ann.optional {
+			lhsStart := comparisonLhsStart(body, predStart, predStart == argStart)
+			if lhsStart == -1 {
+				return "", fmt.Errorf(
+					"optional argument $%d must be compared with a column (as in `col = $%d`)",
+					ann.idx,
+					ann.idx,
+				)
+			}
+			pred = fmt.Sprintf(
+				"(%s IS NULL OR %s%s)",
+				castArg,
+				body[lhsStart:predStart],
+				pred,
+			)
+			predStart = lhsStart
+		}
+
+		body = body[:predStart] + pred + body[predEnd:]
+	}
+
+	return body, nil
+}
+
+// placeholderSpans returns the start and end offsets of each use of the
+// `$idx` placeholder outside of literals and comments.
+func placeholderSpans(body string, idx int) [][2]int {
+	target := strconv.Itoa(idx)
+	var spans [][2]int
+	for i := 0; i < len(body); {
+		if end := endOfNonCode(body, i); end > i {
+			i = end
+			continue
+		}
+		if body[i] != '$' {
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(body) && isDigit(body[end]) {
+			end++
+		}
+		if body[i+1:end] == target {
+			spans = append(spans, [2]int{i, end})
+		}
+		i = end
+	}
+	return spans
+}
+
+// inListAround checks if the placeholder at [argStart, argEnd) is the only
+// element of an `IN (...)` or `NOT IN (...)` list. If so, it returns the
+// span of the list, starting from the `IN` or `NOT` keyword.
+func inListAround(body string, argStart int, argEnd int) (start int, end int, negated bool, ok bool) {
+	before := strings.TrimRight(body[:argStart], " \t\n")
+	if !strings.HasSuffix(before, "(") {
+		return 0, 0, false, false
+	}
+	after := strings.TrimLeft(body[argEnd:], " \t\n")
+	if !strings.HasPrefix(after, ")") {
+		return 0, 0, false, false
+	}
+	end = len(body) - len(after) + 1
+
+	before = strings.TrimRight(before[:len(before)-1], " \t\n")
+	start, word := lastWord(before)
+	if !strings.EqualFold(word, "in") {
+		return 0, 0, false, false
+	}
+
+	notStart, word := lastWord(strings.TrimRight(before[:start], " \t\n"))
+	if strings.EqualFold(word, "not") {
+		return notStart, end, true, true
+	}
+	return start, end, false, true
+}
+
+// comparisonLhsStart finds the start of the left hand side of the comparison
+// whose operator ends just before `opEnd`. If `hasOp` is false, the left hand
+// side ends at `opEnd` instead. The left hand side must be a simple (possibly
+// qualified or quoted) name. Returns -1 if there is no such comparison.
+func comparisonLhsStart(body string, opEnd int, hasOp bool) int {
+	before := strings.TrimRight(body[:opEnd], " \t\n")
+
+	if hasOp {
+		opStart := len(before)
+		for opStart > 0 && isOperatorChar(before[opStart-1]) {
+			opStart--
+		}
+		if opStart == len(before) {
+			// no symbolic operator, so look for LIKE or ILIKE
+			var word string
+			opStart, word = lastWord(before)
+			if !strings.EqualFold(word, "like") && !strings.EqualFold(word, "ilike") {
+				return -1
+			}
+		}
+		before = strings.TrimRight(before[:opStart], " \t\n")
+		if notStart, word := lastWord(before); strings.EqualFold(word, "not") {
+			before = strings.TrimRight(before[:notStart], " \t\n")
+		}
+	}
+
+	// now consume the name
+	lhsStart := len(before)
+	for lhsStart > 0 {
+		c := before[lhsStart-1]
+		if isIdentChar(c) || c == '.' {
+			lhsStart--
+		} else if c == '"' {
+			quoteStart := strings.LastIndexByte(before[:lhsStart-1], '"')
+			if quoteStart == -1 {
+				return -1
+			}
+			lhsStart = quoteStart
+		} else {
+			break
+		}
+	}
+	if lhsStart == len(before) {
+		return -1
+	}
+	if _, word := lastWord(before); isKeyword(word) {
+		return -1
+	}
+	return lhsStart
+}
+
+// lastWord returns the trailing run of identifier characters in `s` along
+// with its start offset.
+func lastWord(s string) (int, string) {
+	start := len(s)
+	for start > 0 && isIdentChar(s[start-1]) {
+		start--
+	}
+	return start, s[start:]
+}
+
+// isKeyword returns true for the keywords which could directly precede a
+// comparison operator, meaning that there is no left hand side.
+func isKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "where", "and", "or", "on", "not", "when", "then", "else", "having", "select":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package meta
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRewriteAnnotatedArg(t *testing.T) {
+	type testCase struct {
+		// inputs
+		body string
+		ann  argAnnotation
+		// outputs
+		rewritten string
+		err       string
+	}
+
+	cases := []testCase{
+		{
+			body:      "SELECT * FROM foos WHERE id IN ($1)",
+			ann:       argAnnotation{idx: 1, pgType: "bigint", slice: true},
+			rewritten: "SELECT * FROM foos WHERE id = ANY($1::bigint[])",
+		},
+		{
+			body:      "SELECT * FROM foos WHERE id not in ( $1 ) AND x = $2",
+			ann:       argAnnotation{idx: 1, pgType: "bigint", slice: true},
+			rewritten: "SELECT * FROM foos WHERE id <> ALL($1::bigint[]) AND x = $2",
+		},
+		{
+			body:      "SELECT * FROM foos WHERE name LIKE $1",
+			ann:       argAnnotation{idx: 1, pgType: "text", slice: true},
+			rewritten: "SELECT * FROM foos WHERE name LIKE ANY($1::text[])",
+		},
+		{
+			body:      "SELECT * FROM foos WHERE name = $1",
+			ann:       argAnnotation{idx: 1, pgType: "text", optional: true},
+			rewritten: "SELECT * FROM foos WHERE ($1::text IS NULL OR name = $1)",
+		},
+		{
+			body:      "SELECT * FROM foos f WHERE f.x >= $2 AND f.\"Weird Name\" NOT ILIKE $1",
+			ann:       argAnnotation{idx: 1, pgType: "text", optional: true},
+			rewritten: "SELECT * FROM foos f WHERE f.x >= $2 AND ($1::text IS NULL OR f.\"Weird Name\" NOT ILIKE $1)",
+		},
+		{
+			body:      "SELECT * FROM foos WHERE id IN ($1) OR parent_id IN ($1)",
+			ann:       argAnnotation{idx: 1, pgType: "bigint", slice: true, optional: true},
+			rewritten: "SELECT * FROM foos WHERE ($1::bigint[] IS NULL OR id = ANY($1::bigint[])) OR ($1::bigint[] IS NULL OR parent_id = ANY($1::bigint[]))",
+		},
+		{
+			body:      "SELECT * FROM foos WHERE x = $10 AND y = $1",
+			ann:       argAnnotation{idx: 1, pgType: "int", optional: true},
+			rewritten: "SELECT * FROM foos WHERE x = $10 AND ($1::int IS NULL OR y = $1)",
+		},
+		{
+			body:      "SELECT '$1', x FROM foos WHERE y = $1 -- $1",
+			ann:       argAnnotation{idx: 1, pgType: "int", optional: true},
+			rewritten: "SELECT '$1', x FROM foos WHERE ($1::int IS NULL OR y = $1) -- $1",
+		},
+		{
+			body: "SELECT * FROM foos WHERE x = $2",
+			ann:  argAnnotation{idx: 1, pgType: "int", optional: true},
+			err:  "never used",
+		},
+		{
+			body: "SELECT * FROM foos WHERE $1 = x",
+			ann:  argAnnotation{idx: 1, pgType: "int", optional: true},
+			err:  "must be compared with a column",
+		},
+		{
+			body: "SELECT * FROM foos WHERE lower(x) = $1",
+			ann:  argAnnotation{idx: 1, pgType: "text", optional: true},
+			err:  "must be compared with a column",
+		},
+		{
+			body: "SELECT $1 FROM foos",
+			ann:  argAnnotation{idx: 1, pgType: "text", optional: true},
+			err:  "must be compared with a column",
+		},
+	}
+
+	for i, c := range cases {
+		rewritten, err := rewriteAnnotatedArg(c.body, c.ann)
+
+		if c.err == "" && err != nil {
+			t.Fatalf("%d: got err when expecting none: %s", i, err.Error())
+		}
+
+		if c.err != "" {
+			if err == nil {
+				t.Fatalf("%d: got no err when expecting one to match /%s/", i, c.err)
+			}
+			matched, regexErr := regexp.Match(c.err, []byte(err.Error()))
+			if regexErr != nil {
+				t.Fatalf("%d: bad pattern /%s/", i, c.err)
+			}
+			if !matched {
+				t.Fatalf("%d: expected err '%s' to match pattern /%s/", i, err.Error(), c.err)
+			}
+			continue
+		}
+
+		if rewritten != c.rewritten {
+			t.Fatalf("%d: expected:\n%s\ngot:\n%s", i, c.rewritten, rewritten)
+		}
+	}
+}
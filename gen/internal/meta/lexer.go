@@ -0,0 +1,111 @@
+package meta
+
+import (
+	"strings"
+)
+
+// file: lexer.go
+// This file contains the minimal amount of SQL lexing that we need in order
+// to find the parts of a query body that are actually code, as opposed to
+// string literals, quoted identifiers, dollar quoted strings or comments.
+// Everything that needs to scan a query body should use it so that the
+// different passes agree about where literals start and end.
+
+// endOfNonCode returns the index just past the end of the string literal,
+// quoted identifier, dollar quoted string or comment starting at `start`.
+// If nothing like that starts at `start`, it returns `start`.
+func endOfNonCode(body string, start int) int {
+	switch {
+	case body[start] == '\'' || body[start] == '"':
+		return endOfQuoted(body, start, isEscapeString(body, start))
+	case strings.HasPrefix(body[start:], "--"):
+		end := strings.IndexByte(body[start:], '\n')
+		if end == -1 {
+			return len(body)
+		}
+		return start + end
+	case strings.HasPrefix(body[start:], "/*"):
+		end := strings.Index(body[start+2:], "*/")
+		if end == -1 {
+			return len(body)
+		}
+		return start + end + 4
+	case body[start] == '$':
+		end := endOfDollarQuoted(body, start)
+		if end == start+1 {
+			// just a lone `$` or a `$N` placeholder
+			return start
+		}
+		return end
+	}
+	return start
+}
+
+// endOfQuoted returns the index just past the end of the string literal or
+// quoted identifier starting at `start`.
+func endOfQuoted(body string, start int, backslashEscapes bool) int {
+	quote := body[start]
+	for i := start + 1; i < len(body); i++ {
+		switch {
+		case backslashEscapes && body[i] == '\\':
+			i++
+		case body[i] == quote:
+			if i+1 < len(body) && body[i+1] == quote {
+				// a doubled quote is an escaped quote
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(body)
+}
+
+// isEscapeString returns true if the quote at `start` opens an `E'...'`
+// string in which backslashes escape characters.
+func isEscapeString(body string, start int) bool {
+	if body[start] != '\'' || start == 0 {
+		return false
+	}
+	prev := body[start-1]
+	return (prev == 'E' || prev == 'e') && (start == 1 || !isIdentChar(body[start-2]))
+}
+
+// endOfDollarQuoted returns the index just past the end of the dollar quoted
+// string starting at `start`. If `start` does not begin a dollar quoted string
+// it just returns the index of the next character.
+func endOfDollarQuoted(body string, start int) int {
+	tagEnd := start + 1
+	if tagEnd < len(body) && isIdentStart(body[tagEnd]) {
+		tagEnd = identEnd(body, tagEnd)
+	}
+	if tagEnd >= len(body) || body[tagEnd] != '$' {
+		return start + 1
+	}
+	tag := body[start : tagEnd+1]
+	end := strings.Index(body[tagEnd+1:], tag)
+	if end == -1 {
+		return len(body)
+	}
+	return tagEnd + 1 + end + len(tag)
+}
+
+func identEnd(s string, start int) int {
+	i := start
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
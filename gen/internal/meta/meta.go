@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/opendoor/pggen/gen/internal/config"
 	"github.com/opendoor/pggen/gen/internal/log"
@@ -74,6 +75,13 @@ type Arg struct {
 	GoName string
 	// The postgres name of this argument
 	PgName string
+	// The postgres type of this argument
+	PgType string
+	// The name of the field holding this argument in the params struct
+	// generated when `args_struct` is set.
+	FieldName string
+	// If true, the argument should be passed as a nullable (boxed) value
+	Nullable bool
 	// Information about the go version of this type
 	TypeInfo types.Info
 }
@@ -109,61 +117,100 @@ func (mc *Resolver) QueryMeta(
 
 	ret.Comment = configCommentToGoComment(config.Comment)
 
+	body, argNamesSpec, err := resolveNamedArgs(config.Body, config.ArgNames)
+	if err != nil {
+		return
+	}
+	ret.ConfigData.Body = body
+
 	if inferArgTypes {
 		var args []Arg
-		args, err = mc.argsOfStmt(config.Body, config.ArgNames)
+		args, err = mc.argsOfStmt(body, argNamesSpec)
 		if err != nil {
 			err = fmt.Errorf("getting query argument types: %s", err.Error())
 			return
 		}
+		body, err = mc.annotateArgs(body, args, config.NullableArguments, config.SliceArgs, config.OptionalArgs)
+		if err != nil {
+			return
+		}
+		ret.ConfigData.Body = body
 		ret.Args = args
+
+		if config.ArgsStruct {
+			err = checkArgFieldNames(args)
+			if err != nil {
+				return
+			}
+		}
 	}
 
 	// Resolve the return type by factoring in the null flags and
 	// whether or not it is an alias for a table type.
-	nullFlags := config.NullFlags
-	pgTableName, isTable := mc.tableResolver.meta.tableTyNameToTableName[config.ReturnType]
-	if isTable {
-		if len(config.NullFlags) > 0 || len(config.NotNullFields) > 0 {
-			err = fmt.Errorf("don't set null flags on query returning table struct")
-			return
-		}
-
-		nullFlags = mc.tableResolver.meta.tableInfo[pgTableName].nullFlags()
+	nullFlags, isTable, err := mc.returnNullFlags(config.ReturnType, config.NullFlags, config.NotNullFields)
+	if err != nil {
+		return
 	}
-	returnCols, err := mc.queryReturns(config.Body)
+	returnCols, err := mc.queryReturns(body)
 	if err != nil {
 		return
 	}
+	if config.InferNullability && !isTable {
+		err = mc.inferNullability(body, returnCols)
+		if err != nil {
+			err = fmt.Errorf("infering result nullability: %s", err.Error())
+			return
+		}
+	}
 	err = overrideNullability(returnCols, nullFlags, config.NotNullFields)
 	if err != nil {
 		return
 	}
 	ret.ReturnCols = returnCols
 
-	if len(ret.ReturnCols) == 1 {
-		ret.MultiReturn = false
-		if ret.ReturnCols[0].Nullable {
-			ret.ReturnTypeName = ret.ReturnCols[0].TypeInfo.NullName
-		} else {
-			ret.ReturnTypeName = ret.ReturnCols[0].TypeInfo.Name
-		}
+	ret.MultiReturn, ret.ReturnTypeName, err = returnTypeNameOf(returnCols, config.ReturnType, ret.ConfigData.Name)
+	return
+}
 
-		if len(config.ReturnType) > 0 {
-			err = fmt.Errorf("return_type cannot be provided for a query returning a primitive")
-			return
+// returnNullFlags works out the null flags that should be applied to the result
+// columns of a query or statement given its config. The second return value
+// indicates if the return type is a table struct, in which case the nullability
+// comes from the table.
+func (mc *Resolver) returnNullFlags(
+	returnType string,
+	nullFlags string,
+	notNullFields []string,
+) (string, bool, error) {
+	pgTableName, isTable := mc.tableResolver.meta.tableTyNameToTableName[returnType]
+	if !isTable {
+		return nullFlags, false, nil
+	}
+
+	if len(nullFlags) > 0 || len(notNullFields) > 0 {
+		return "", false, fmt.Errorf("don't set null flags on query returning table struct")
+	}
+	return mc.tableResolver.meta.tableInfo[pgTableName].nullFlags(), true, nil
+}
+
+// returnTypeNameOf determines the go type that each result row of a query or
+// statement should be returned as. The first return value indicates if there are
+// multiple result columns, so that the return type is a struct.
+func returnTypeNameOf(returnCols []ColMeta, returnType string, name string) (bool, string, error) {
+	if len(returnCols) == 1 {
+		if len(returnType) > 0 {
+			return false, "", fmt.Errorf("return_type cannot be provided for a query returning a primitive")
 		}
-	} else {
-		ret.MultiReturn = true
-		if len(config.ReturnType) > 0 {
-			ret.ReturnTypeName = config.ReturnType
-		} else {
-			ret.ReturnTypeName = ret.ConfigData.Name + "Row"
+
+		if returnCols[0].Nullable {
+			return false, returnCols[0].TypeInfo.NullName, nil
 		}
+		return false, returnCols[0].TypeInfo.Name, nil
 	}
-	ret.MultiReturn = len(ret.ReturnCols) > 1
 
-	return
+	if len(returnType) > 0 {
+		return true, returnType, nil
+	}
+	return true, name + "Row", nil
 }
 
 type StmtMeta struct {
@@ -173,6 +220,15 @@ type StmtMeta struct {
 	Comment string
 	// The metadata for the arguments to this query
 	Args []Arg
+	// True if this statement has a RETURNING clause, in which case the
+	// following fields describe the rows that it returns.
+	Returning bool
+	// The metadata for the columns in the RETURNING clause
+	ReturnCols []ColMeta
+	// Flag indicating if there are multiple returned columns.
+	MultiReturn bool
+	// The name of the return type for a row returned by this statement
+	ReturnTypeName string
 }
 
 func (mc *Resolver) StmtMeta(
@@ -182,16 +238,181 @@ func (mc *Resolver) StmtMeta(
 
 	ret.Comment = configCommentToGoComment(config.Comment)
 
-	args, err := mc.argsOfStmt(config.Body, config.ArgNames)
+	body, argNamesSpec, err := resolveNamedArgs(config.Body, config.ArgNames)
+	if err != nil {
+		return
+	}
+	ret.ConfigData.Body = body
+
+	args, err := mc.argsOfStmt(body, argNamesSpec)
 	if err != nil {
 		err = fmt.Errorf("getting statement argument types: %s", err.Error())
 		return
 	}
+	body, err = mc.annotateArgs(body, args, config.NullableArguments, config.SliceArgs, config.OptionalArgs)
+	if err != nil {
+		return
+	}
+	ret.ConfigData.Body = body
 	ret.Args = args
 
+	if config.ArgsStruct {
+		err = checkArgFieldNames(args)
+		if err != nil {
+			return
+		}
+	}
+
+	returnCols, err := mc.stmtReturns(body)
+	if err != nil {
+		err = fmt.Errorf("getting RETURNING columns: %s", err.Error())
+		return
+	}
+	if len(returnCols) == 0 {
+		if len(config.ReturnType) > 0 || config.SingleResult ||
+			len(config.NullFlags) > 0 || len(config.NotNullFields) > 0 {
+			err = fmt.Errorf(
+				"return_type, single_result and null flags can only be provided for a statement with a RETURNING clause",
+			)
+		}
+		return
+	}
+	ret.Returning = true
+
+	nullFlags, isTable, err := mc.returnNullFlags(config.ReturnType, config.NullFlags, config.NotNullFields)
+	if err != nil {
+		return
+	}
+	if !isTable {
+		// The columns in a RETURNING clause almost always come straight from the
+		// table being modified, so inference is very reliable.
+		err = mc.inferNullability(body, returnCols)
+		if err != nil {
+			err = fmt.Errorf("infering result nullability: %s", err.Error())
+			return
+		}
+	}
+	err = overrideNullability(returnCols, nullFlags, config.NotNullFields)
+	if err != nil {
+		return
+	}
+	ret.ReturnCols = returnCols
+
+	ret.MultiReturn, ret.ReturnTypeName, err = returnTypeNameOf(returnCols, config.ReturnType, ret.ConfigData.Name)
 	return
 }
 
+// checkArgFieldNames makes sure that no two arguments map to the same
+// field in a generated params struct.
+func checkArgFieldNames(args []Arg) error {
+	seen := make(map[string]string, len(args))
+	for _, arg := range args {
+		if other, ok := seen[arg.FieldName]; ok {
+			return fmt.Errorf(
+				"args_struct: arguments '%s' and '%s' both map to the field '%s'",
+				other,
+				arg.GoName,
+				arg.FieldName,
+			)
+		}
+		seen[arg.FieldName] = arg.GoName
+	}
+	return nil
+}
+
+// resolveNamedArgs rewrites any named arguments in `body` into positional
+// placeholders and returns the new body along with an arg_names spec
+// giving the positional arguments their names.
+func resolveNamedArgs(body string, argNamesSpec string) (string, string, error) {
+	positionalBody, argNames, err := namedArgsToPositional(body)
+	if err != nil {
+		return "", "", fmt.Errorf("resolving named arguments: %s", err.Error())
+	}
+	if argNames == nil {
+		return body, argNamesSpec, nil
+	}
+	if argNamesSpec != "" {
+		return "", "", fmt.Errorf("arg_names cannot be provided for a body with named arguments")
+	}
+
+	specParts := make([]string, len(argNames))
+	for i, name := range argNames {
+		specParts[i] = fmt.Sprintf("%d:%s", i+1, name)
+	}
+	return positionalBody, strings.Join(specParts, " "), nil
+}
+
+// annotateArgs applies the `nullable_arguments`, `slice_args` and `optional_args`
+// config options to the given arguments and returns the query body rewritten to
+// match.
+//
+// Mutates `args`
+func (mc *Resolver) annotateArgs(
+	body string,
+	args []Arg,
+	nullableArguments bool,
+	sliceArgs []string,
+	optionalArgs []string,
+) (string, error) {
+	argIdxs := make(map[string]int, len(args))
+	for i := range args {
+		args[i].Nullable = nullableArguments
+		argIdxs[args[i].GoName] = i
+	}
+
+	anns := make([]argAnnotation, len(args))
+	for i := range args {
+		anns[i] = argAnnotation{idx: args[i].Idx, pgType: args[i].PgType}
+	}
+	for _, name := range sliceArgs {
+		i, ok := argIdxs[name]
+		if !ok {
+			return "", fmt.Errorf("slice_args: unknown argument '%s'", name)
+		}
+		anns[i].slice = true
+	}
+	for _, name := range optionalArgs {
+		i, ok := argIdxs[name]
+		if !ok {
+			return "", fmt.Errorf("optional_args: unknown argument '%s'", name)
+		}
+		anns[i].optional = true
+	}
+
+	for i, ann := range anns {
+		if !ann.slice && !ann.optional {
+			continue
+		}
+
+		var err error
+		body, err = rewriteAnnotatedArg(body, ann)
+		if err != nil {
+			return "", fmt.Errorf("rewriting argument '%s': %s", args[i].GoName, err.Error())
+		}
+
+		if ann.slice {
+			if strings.HasSuffix(ann.pgType, "[]") {
+				return "", fmt.Errorf(
+					"slice_args: argument '%s' is already an array (%s)",
+					args[i].GoName,
+					ann.pgType,
+				)
+			}
+			typeInfo, err := mc.typeResolver.TypeInfoOf(ann.pgType + "[]")
+			if err != nil {
+				return "", fmt.Errorf("resolving type info: %s", err.Error())
+			}
+			args[i].PgType = ann.pgType + "[]"
+			args[i].TypeInfo = *typeInfo
+		} else {
+			// a nil slice is already passed as NULL, so only scalars need boxing
+			args[i].Nullable = true
+		}
+	}
+
+	return body, nil
+}
+
 // argsOfStmt infers the types of all the placeholders in the `body` statement
 // and uses that to generate a list of argument metadata
 func (mc *Resolver) argsOfStmt(body string, argNamesSpec string) ([]Arg, error) {
@@ -249,10 +470,12 @@ func (mc *Resolver) argsOfStmt(body string, argNamesSpec string) ([]Arg, error)
 			return nil, fmt.Errorf("resolving type info: %s", err.Error())
 		}
 		args = append(args, Arg{
-			Idx:      i + 1,
-			GoName:   name,
-			PgName:   name,
-			TypeInfo: *typeInfo,
+			Idx:       i + 1,
+			GoName:    name,
+			PgName:    name,
+			PgType:    t,
+			FieldName: names.PgToGoName(name),
+			TypeInfo:  *typeInfo,
 		})
 	}
 
@@ -0,0 +1,128 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+)
+
+// file: named_args.go
+// This file contains the logic for rewriting named query parameters
+// (`@name` or `pggen.arg(name)`) into the positional placeholders
+// that postgres understands.
+
+// namedArgsToPositional rewrites all the named parameters in the given
+// query body into positional `$N` placeholders. It returns the rewritten
+// body along with the names of the arguments in positional order. Repeated
+// uses of the same name are all mapped to the same placeholder.
+//
+// If the body does not contain any named parameters, it is returned unchanged
+// and the returned slice of names is nil. Mixing named and positional parameters
+// in the same body is an error.
+func namedArgsToPositional(body string) (string, []string, error) {
+	var (
+		out           strings.Builder
+		argNames      []string
+		argIdxs       = map[string]int{}
+		hasPositional bool
+		// the first operator directly followed by something that looks like a
+		// named argument
+		ambiguous string
+	)
+
+	bindName := func(name string) {
+		idx, ok := argIdxs[name]
+		if !ok {
+			argNames = append(argNames, name)
+			idx = len(argNames)
+			argIdxs[name] = idx
+		}
+		fmt.Fprintf(&out, "$%d", idx)
+	}
+
+	for i := 0; i < len(body); {
+		if end := endOfNonCode(body, i); end > i {
+			out.WriteString(body[i:end])
+			i = end
+			continue
+		}
+
+		c := body[i]
+		switch {
+		case c == '$' && i+1 < len(body) && isDigit(body[i+1]):
+			hasPositional = true
+			out.WriteByte(c)
+			i++
+		case c == '@' && i > 0 && (body[i-1] == '=' || body[i-1] == '>') &&
+			i+1 < len(body) && isIdentStart(body[i+1]):
+			// `id=@id` looks like a named argument, but postgres would lex `=@`
+			// as a single operator. We only complain about it once we know that the
+			// body uses named arguments. `<@` is a real operator, so it is left alone.
+			end := identEnd(body, i+1)
+			if ambiguous == "" {
+				ambiguous = body[i-1 : end]
+			}
+			out.WriteString(body[i:end])
+			i = end
+		case c == '@' && (i == 0 || !isOperatorChar(body[i-1])) &&
+			i+1 < len(body) && isIdentStart(body[i+1]):
+			end := identEnd(body, i+1)
+			bindName(body[i+1 : end])
+			i = end
+		case (i == 0 || !isIdentChar(body[i-1])) && hasArgFuncPrefix(body[i:]):
+			open := i + strings.IndexByte(body[i:], '(')
+			closeParen := strings.IndexByte(body[open:], ')')
+			if closeParen == -1 {
+				return "", nil, fmt.Errorf("unterminated named argument '%s'", body[i:])
+			}
+			closeParen += open
+			name := strings.TrimSpace(body[open+1 : closeParen])
+			if len(name) >= 2 && name[0] == '\'' && name[len(name)-1] == '\'' {
+				name = name[1 : len(name)-1]
+			}
+			if name == "" || !isIdentStart(name[0]) || identEnd(name, 0) != len(name) {
+				return "", nil, fmt.Errorf("invalid named argument '%s'", body[i:closeParen+1])
+			}
+			bindName(name)
+			i = closeParen + 1
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	if len(argNames) == 0 {
+		return body, nil, nil
+	}
+	if hasPositional {
+		return "", nil, fmt.Errorf("cannot mix named and positional ($N) arguments")
+	}
+	if ambiguous != "" {
+		return "", nil, fmt.Errorf(
+			"ambiguous named argument in '%s': add a space before the '@' to use a named argument",
+			ambiguous,
+		)
+	}
+
+	return out.String(), argNames, nil
+}
+
+// hasArgFuncPrefix returns true if `s` starts with a `pggen.arg(` or
+// `sqlc.arg(` call, ignoring case.
+func hasArgFuncPrefix(s string) bool {
+	for _, prefix := range []string{"pggen.arg", "sqlc.arg"} {
+		if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+			continue
+		}
+		rest := strings.TrimLeft(s[len(prefix):], " \t\n")
+		if strings.HasPrefix(rest, "(") {
+			return true
+		}
+	}
+	return false
+}
+
+// isOperatorChar returns true if `c` can be part of a postgres operator. We
+// use this to avoid treating operators like `<@` as the start of a named argument.
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("+-*/<>=~!@#%^&|`?", c) != -1
+}
@@ -0,0 +1,154 @@
+package meta
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestNamedArgsToPositional(t *testing.T) {
+	type testCase struct {
+		// inputs
+		body string
+		// outputs
+		positionalBody string
+		argNames       []string
+		err            string
+	}
+
+	cases := []testCase{
+		{
+			body:           "SELECT * FROM foos WHERE id = $1",
+			positionalBody: "SELECT * FROM foos WHERE id = $1",
+		},
+		{
+			body:           "SELECT * FROM foos WHERE id = @id",
+			positionalBody: "SELECT * FROM foos WHERE id = $1",
+			argNames:       []string{"id"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE a = @a_val AND b = @bVal",
+			positionalBody: "SELECT * FROM foos WHERE a = $1 AND b = $2",
+			argNames:       []string{"a_val", "bVal"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE a = @x OR b = @y OR c = @x",
+			positionalBody: "SELECT * FROM foos WHERE a = $1 OR b = $2 OR c = $1",
+			argNames:       []string{"x", "y"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE id = pggen.arg(id) AND x = sqlc.arg('x')",
+			positionalBody: "SELECT * FROM foos WHERE id = $1 AND x = $2",
+			argNames:       []string{"id", "x"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE id = PGGEN.ARG( id ) OR other_id = @id",
+			positionalBody: "SELECT * FROM foos WHERE id = $1 OR other_id = $1",
+			argNames:       []string{"id"},
+		},
+		{
+			body:           "SELECT @n::int, @n::text",
+			positionalBody: "SELECT $1::int, $1::text",
+			argNames:       []string{"n"},
+		},
+		{
+			body:           "SELECT '@not_an_arg', \"@col\" FROM foos WHERE x = @x",
+			positionalBody: "SELECT '@not_an_arg', \"@col\" FROM foos WHERE x = $1",
+			argNames:       []string{"x"},
+		},
+		{
+			body:           "SELECT 'it''s @nope' FROM foos WHERE x = @x",
+			positionalBody: "SELECT 'it''s @nope' FROM foos WHERE x = $1",
+			argNames:       []string{"x"},
+		},
+		{
+			body:           "SELECT E'\\'@nope' FROM foos WHERE x = @x",
+			positionalBody: "SELECT E'\\'@nope' FROM foos WHERE x = $1",
+			argNames:       []string{"x"},
+		},
+		{
+			body:           "SELECT $tag$ @nope $tag$, $$ @nope $$ WHERE x = @x",
+			positionalBody: "SELECT $tag$ @nope $tag$, $$ @nope $$ WHERE x = $1",
+			argNames:       []string{"x"},
+		},
+		{
+			body:           "SELECT x -- @nope\nFROM foos /* @nope */ WHERE x = @x",
+			positionalBody: "SELECT x -- @nope\nFROM foos /* @nope */ WHERE x = $1",
+			argNames:       []string{"x"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE tags @> @tags AND ids <@ @ids AND @ -5 = 5",
+			positionalBody: "SELECT * FROM foos WHERE tags @> $1 AND ids <@ $2 AND @ -5 = 5",
+			argNames:       []string{"tags", "ids"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE tags <@@tags",
+			positionalBody: "SELECT * FROM foos WHERE tags <@@tags",
+		},
+		{
+			body:           "SELECT * FROM foos WHERE my_pggen.arg(1) = 1",
+			positionalBody: "SELECT * FROM foos WHERE my_pggen.arg(1) = 1",
+		},
+		{
+			body: "SELECT * FROM foos WHERE a = @a AND b = $2",
+			err:  "cannot mix named and positional",
+		},
+		{
+			body: "SELECT * FROM foos WHERE id=@id AND x = @x",
+			err:  "ambiguous named argument in '=@id': add a space",
+		},
+		{
+			body: "SELECT * FROM foos WHERE x = @x AND a>=@a",
+			err:  "ambiguous named argument in '=@a'",
+		},
+		{
+			body:           "SELECT * FROM foos WHERE a >= 1 AND b<@b",
+			positionalBody: "SELECT * FROM foos WHERE a >= 1 AND b<@b",
+		},
+		{
+			body:           "SELECT * FROM foos WHERE a.tags<@b.tags AND x = @x",
+			positionalBody: "SELECT * FROM foos WHERE a.tags<@b.tags AND x = $1",
+			argNames:       []string{"x"},
+		},
+		{
+			body:           "SELECT * FROM foos WHERE a=@b",
+			positionalBody: "SELECT * FROM foos WHERE a=@b",
+		},
+		{
+			body: "SELECT * FROM foos WHERE a = pggen.arg(1a)",
+			err:  "invalid named argument 'pggen.arg\\(1a\\)'",
+		},
+		{
+			body: "SELECT * FROM foos WHERE a = pggen.arg(a",
+			err:  "unterminated named argument",
+		},
+	}
+
+	for i, c := range cases {
+		positionalBody, argNames, err := namedArgsToPositional(c.body)
+
+		if len(c.err) > 0 {
+			if err == nil {
+				t.Fatalf("%d: expected error matching '%s', got none", i, c.err)
+			}
+			matches, matchErr := regexp.Match(c.err, []byte(err.Error()))
+			if matchErr != nil {
+				t.Fatalf("%d: bad regex: %s", i, matchErr.Error())
+			}
+			if !matches {
+				t.Fatalf("%d: expected error matching '%s', got '%s'", i, c.err, err.Error())
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %s", i, err.Error())
+		}
+		if positionalBody != c.positionalBody {
+			t.Fatalf("%d: expected body '%s', got '%s'", i, c.positionalBody, positionalBody)
+		}
+		if !reflect.DeepEqual(argNames, c.argNames) {
+			t.Fatalf("%d: expected args %v, got %v", i, c.argNames, argNames)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package meta
+
+// file: nullability.go
+// This file contains the logic for infering the nullability of query result
+// columns by tracing them back to the table columns that they come from.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// inferNullability marks each of the given query result columns as NOT NULL
+// if postgres reports that the column comes straight from a NOT NULL table
+// column. `cols` must be in the same order as the result columns of `query`.
+//
+// Postgres will report the source table column for a result column even if
+// that column is on the nullable side of an outer join, so we don't perform
+// any inference at all for queries which might introduce NULLs that way.
+//
+// Mutates its argument
+func (mc *Resolver) inferNullability(query string, cols []ColMeta) error {
+	if mayIntroduceNulls(query) {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	conn, err := stdlib.AcquireConn(mc.db)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %s", err.Error())
+	}
+	defer func() {
+		// we don't care too much if we fail to return the connection to the pool
+		_ = stdlib.ReleaseConn(mc.db, conn)
+	}()
+
+	// the unnamed statement is just described, not persisted
+	desc, err := conn.Prepare(ctx, "", query)
+	if err != nil {
+		return err
+	}
+	if len(desc.Fields) != len(cols) {
+		return fmt.Errorf(
+			"internal pggen error: %d result columns but %d fields in row description",
+			len(cols),
+			len(desc.Fields),
+		)
+	}
+
+	for i, field := range desc.Fields {
+		if field.TableOID == 0 {
+			// an expression rather than a column
+			continue
+		}
+
+		var notNull bool
+		err = mc.db.QueryRow(`
+			SELECT a.attnotnull
+			FROM pg_attribute a
+			WHERE a.attrelid = $1
+			  AND a.attnum = $2
+			`, int64(field.TableOID), int64(field.TableAttributeNumber)).Scan(&notNull)
+		if err != nil {
+			return fmt.Errorf("looking up source of column '%s': %s", cols[i].PgName, err.Error())
+		}
+
+		if notNull {
+			cols[i].Nullable = false
+		}
+	}
+
+	return nil
+}
+
+var nullIntroducingRE = regexp.MustCompile(
+	`\b((LEFT|RIGHT|FULL)\s+(OUTER\s+)?JOIN|ROLLUP|CUBE|GROUPING\s+SETS)\b`,
+)
+
+// mayIntroduceNulls returns true if the given query contains a construct that
+// can produce NULL values for a column that is NOT NULL in the table it is
+// drawn from (outer joins and grouping sets).
+func mayIntroduceNulls(query string) bool {
+	return nullIntroducingRE.MatchString(strings.ToUpper(stripLiterals(query)))
+}
+
+// stripLiterals removes all string literals, quoted identifiers and comments
+// from the given query so that keyword searches don't produce false positives.
+func stripLiterals(query string) string {
+	var out strings.Builder
+	for i := 0; i < len(query); {
+		if end := endOfNonCode(query, i); end > i {
+			out.WriteByte(' ')
+			i = end
+			continue
+		}
+		out.WriteByte(query[i])
+		i++
+	}
+	return out.String()
+}
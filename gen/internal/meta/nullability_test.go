@@ -0,0 +1,97 @@
+package meta
+
+import (
+	"testing"
+)
+
+func TestMayIntroduceNulls(t *testing.T) {
+	type testCase struct {
+		query    string
+		expected bool
+	}
+
+	cases := []testCase{
+		{
+			query:    "SELECT id FROM foos",
+			expected: false,
+		},
+		{
+			query:    "SELECT f.id FROM foos f JOIN bars b ON (f.id = b.foo_id)",
+			expected: false,
+		},
+		{
+			query:    "SELECT f.id FROM foos f INNER JOIN bars b ON (f.id = b.foo_id)",
+			expected: false,
+		},
+		{
+			query:    "SELECT f.id FROM foos f LEFT JOIN bars b ON (f.id = b.foo_id)",
+			expected: true,
+		},
+		{
+			query:    "SELECT f.id FROM foos f left outer join bars b ON (f.id = b.foo_id)",
+			expected: true,
+		},
+		{
+			query: `SELECT f.id
+			        FROM foos f
+			        RIGHT
+			        JOIN bars b ON (f.id = b.foo_id)`,
+			expected: true,
+		},
+		{
+			query:    "SELECT f.id FROM foos f FULL OUTER JOIN bars b ON (f.id = b.foo_id)",
+			expected: true,
+		},
+		{
+			query:    "SELECT a, b, count(*) FROM foos GROUP BY ROLLUP (a, b)",
+			expected: true,
+		},
+		{
+			query:    "SELECT a, b, count(*) FROM foos GROUP BY GROUPING SETS ((a), (b))",
+			expected: true,
+		},
+		{
+			query:    "SELECT 'left join' AS t FROM foos",
+			expected: false,
+		},
+		{
+			query:    `SELECT "left join" FROM foos`,
+			expected: false,
+		},
+		{
+			query:    "SELECT 'it''s a left join' FROM foos",
+			expected: false,
+		},
+		{
+			query:    "SELECT E'it\\'s a left join' FROM foos",
+			expected: false,
+		},
+		{
+			query:    "SELECT $$ left join $$, $tag$ full join $tag$ FROM foos",
+			expected: false,
+		},
+		{
+			query:    "SELECT E'\\'' AS q FROM foos f LEFT JOIN bars b ON (f.id = b.foo_id)",
+			expected: true,
+		},
+		{
+			query:    "SELECT id FROM foos -- left join bars\n",
+			expected: false,
+		},
+		{
+			query:    "SELECT id /* left join */ FROM foos",
+			expected: false,
+		},
+		{
+			query:    "SELECT id FROM leftjoins",
+			expected: false,
+		},
+	}
+
+	for i, c := range cases {
+		actual := mayIntroduceNulls(c.query)
+		if actual != c.expected {
+			t.Fatalf("%d: expected %t, got %t for query: %s", i, c.expected, actual, c.query)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package meta
+
+// file: returning.go
+// This file contains the logic for resolving the rows returned by statements
+// with a RETURNING clause. Such statements cannot be used to define a view, so
+// we can't use the same trick that we use to resolve query return types.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/stdlib"
+
+	"github.com/opendoor/pggen/gen/internal/names"
+)
+
+// stmtReturns returns metadata about the columns that the given statement
+// returns based on the row description postgres provides when the statement
+// is prepared. All of the columns are nullable. Statements which don't return
+// any rows have no columns.
+func (mc *Resolver) stmtReturns(body string) ([]ColMeta, error) {
+	ctx := context.Background()
+
+	conn, err := stdlib.AcquireConn(mc.db)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring connection: %s", err.Error())
+	}
+	defer func() {
+		// we don't care too much if we fail to return the connection to the pool
+		_ = stdlib.ReleaseConn(mc.db, conn)
+	}()
+
+	// the unnamed statement is just described, not executed
+	desc, err := conn.Prepare(ctx, "", body)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]ColMeta, 0, len(desc.Fields))
+	for i, field := range desc.Fields {
+		col := ColMeta{
+			ColNum:   int32(i + 1),
+			PgName:   string(field.Name),
+			GoName:   names.PgToGoName(string(field.Name)),
+			Nullable: true,
+		}
+
+		err = mc.db.QueryRow(
+			`SELECT format_type($1, $2)`,
+			int64(field.DataTypeOID),
+			field.TypeModifier,
+		).Scan(&col.PgType)
+		if err != nil {
+			return nil, fmt.Errorf("looking up type of column '%s': %s", col.PgName, err.Error())
+		}
+
+		typeInfo, err := mc.typeResolver.TypeInfoOf(col.PgType)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %s", col.PgName, err.Error())
+		}
+		col.TypeInfo = *typeInfo
+
+		cols = append(cols, col)
+	}
+
+	return cols, nil
+}
@@ -66,6 +66,11 @@ type TableMeta struct {
 	AllIncomingReferences []RefMeta
 	// All references from this table to other tables (both infered and configured).
 	AllOutgoingReferences []RefMeta
+	// All many-to-many references from this table to other tables by way of
+	// a join table (both infered and configured).
+	AllThroughReferences []ThroughRefMeta
+	// True if some other table has a many-to-many reference to this table
+	ThroughReferenceTarget bool
 	// The include spec which represents the transitive closure of
 	// this tables family
 	AllIncludeSpec *include.Spec
@@ -162,6 +167,10 @@ func (tr *tableResolver) populateTableInfo(tables []config.TableConfig) error {
 		return err
 	}
 	populateOutgoingReferencesMapping(tr.meta.tableInfo)
+	err = tr.buildThroughReferencesMapping(tables, tr.meta.tableInfo)
+	if err != nil {
+		return err
+	}
 
 	// fill in all the allIncludeSpecs
 	for _, meta := range tr.meta.tableInfo {
@@ -182,6 +191,31 @@ func (tr *tableResolver) populateTableInfo(tables []config.TableConfig) error {
 		}
 	}
 
+	for _, meta := range tr.meta.tableInfo {
+		err := validateIncludePredicates(meta.Config)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateIncludePredicates(table *config.TableConfig) error {
+	seen := make(map[string]bool, len(table.IncludePredicates))
+	for _, pred := range table.IncludePredicates {
+		if len(pred.Name) == 0 {
+			return fmt.Errorf("%s: include_predicate requires 'name' key", table.Name)
+		}
+		if len(pred.Sql) == 0 {
+			return fmt.Errorf("%s: include_predicate '%s' requires 'sql' key", table.Name, pred.Name)
+		}
+		if seen[pred.Name] {
+			return fmt.Errorf("%s: duplicate include_predicate '%s'", table.Name, pred.Name)
+		}
+		seen[pred.Name] = true
+	}
+
 	return nil
 }
 
@@ -337,6 +371,15 @@ func ensureSpec(tables map[string]*TableMeta, meta *TableMeta) error {
 		}
 	}
 
+	for _, ref := range meta.AllThroughReferences {
+		subInfo := tables[ref.PointsTo.Info.PgName]
+		err := ensureSpec(tables, subInfo)
+		if err != nil {
+			return err
+		}
+		meta.AllIncludeSpec.Includes[ref.PgFieldName] = subInfo.AllIncludeSpec
+	}
+
 	if len(meta.AllIncludeSpec.Includes) == 0 {
 		meta.AllIncludeSpec.Includes = nil
 	}
@@ -564,6 +607,24 @@ type PgTableInfo struct {
 	IncomingReferences []RefMeta
 	// The 0-based index of the primary key column
 	PkeyColIdx int
+	// The schema that the table lives in, exactly as postgres reports it
+	PgSchema string
+	// The name of the table within its schema, exactly as postgres reports it
+	PgRelName string
+	// The constraints on the table, sorted by name
+	Constraints []ConstraintMeta
+}
+
+// ConstraintMeta contains metadata about a constraint on a table (or a unique
+// index, which postgres reports violations of in exactly the same way).
+type ConstraintMeta struct {
+	// the name of the constraint in postgres
+	PgName string
+	// the name of the constraint with the table name prefix that postgres
+	// generates stripped off, converted to go style
+	GoName string
+	// the postgres names of the columns covered by the constraint
+	Cols []string
 }
 
 // ColMeta contains metadata about postgres table columns such column
@@ -686,6 +747,11 @@ func (tr *tableResolver) tableInfo(table *config.TableConfig) (PgTableInfo, erro
 		}
 	}
 
+	constraints, err := tr.tableConstraints(tableName, cols)
+	if err != nil {
+		return PgTableInfo{}, err
+	}
+
 	goName := names.PgTableToGoModel(table.Name)
 	return PgTableInfo{
 		PgName: tableName.String(),
@@ -697,9 +763,110 @@ func (tr *tableResolver) tableInfo(table *config.TableConfig) (PgTableInfo, erro
 		PkeyCol:      pkeyCol,
 		PkeyColIdx:   pkeyColIdx,
 		Cols:         cols,
+		PgSchema:     tableName.Schema,
+		PgRelName:    tableName.Name,
+		Constraints:  constraints,
 	}, nil
 }
 
+// tableConstraints fetches the constraints on the given table, along with any unique
+// indexes which do not back a constraint.
+func (tr *tableResolver) tableConstraints(tableName names.PgName, cols []ColMeta) ([]ConstraintMeta, error) {
+	rows, err := tr.db.Query(`
+		SELECT
+			c.conname AS name,
+			COALESCE(c.conkey, '{}'::int2[]) AS col_nums
+		FROM pg_constraint c
+		JOIN pg_class t
+			ON (t.oid = c.conrelid)
+		JOIN pg_namespace ns
+			ON (t.relnamespace = ns.oid)
+		WHERE ns.nspname = $1
+		  AND t.relname = $2
+		  AND c.contype <> 'n'
+
+		UNION ALL
+
+		SELECT
+			i.relname AS name,
+			ix.indkey::int2[] AS col_nums
+		FROM pg_index ix
+		JOIN pg_class i
+			ON (i.oid = ix.indexrelid)
+		JOIN pg_class t
+			ON (t.oid = ix.indrelid)
+		JOIN pg_namespace ns
+			ON (t.relnamespace = ns.oid)
+		WHERE ns.nspname = $1
+		  AND t.relname = $2
+		  AND ix.indisunique
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint c
+			WHERE c.conrelid = ix.indrelid AND c.conindid = ix.indexrelid
+		  )
+
+		ORDER BY name
+		`, tableName.Schema, tableName.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colNumToIdx := columnResolverTable(cols)
+
+	var constraints []ConstraintMeta
+	for rows.Next() {
+		var (
+			constraint ConstraintMeta
+			colNums    = []int64{}
+		)
+		err = rows.Scan(&constraint.PgName, pgtypes.Array(&colNums))
+		if err != nil {
+			return nil, err
+		}
+
+		constraint.Cols = []string{}
+		for _, colNum := range colNums {
+			// expression indexes have a 0 in place of the columns they cover
+			if colNum <= 0 || int64(len(colNumToIdx)) <= colNum {
+				continue
+			}
+			constraint.Cols = append(constraint.Cols, cols[colNumToIdx[colNum]].PgName)
+		}
+
+		constraints = append(constraints, constraint)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	assignConstraintGoNames(tableName.Name, constraints)
+
+	return constraints, nil
+}
+
+// assignConstraintGoNames fills in the go names for the given constraints. Postgres
+// names constraints `<table>_<columns>_<kind>` by default, so we strip off the table
+// name in order to avoid stuttering when the name gets prefixed with the name of
+// the table's model struct. If that makes two names collide, we fall back on the
+// full name of the constraint, and then on numbering the colliding names.
+func assignConstraintGoNames(relName string, constraints []ConstraintMeta) {
+	seen := make(map[string]bool, len(constraints))
+	for i := range constraints {
+		c := &constraints[i]
+		c.GoName = names.PgToGoName(strings.TrimPrefix(c.PgName, relName+"_"))
+		if seen[c.GoName] {
+			c.GoName = names.PgToGoName(c.PgName)
+		}
+		base := c.GoName
+		for n := 2; seen[c.GoName]; n++ {
+			c.GoName = base + strconv.Itoa(n)
+		}
+		seen[c.GoName] = true
+	}
+}
+
 func (tr *tableResolver) typeInfoOfCol(conf *config.TableConfig, colName string, colType string) (*types.Info, error) {
 	var jsonOverride *config.JsonType
 	for i, jsonType := range conf.JsonTypes {
@@ -0,0 +1,54 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssignConstraintGoNames(t *testing.T) {
+	type testCase struct {
+		relName string
+		pgNames []string
+		goNames []string
+	}
+
+	cases := []testCase{
+		{
+			relName: "users",
+			pgNames: []string{"users_email_key", "users_pkey"},
+			goNames: []string{"EmailKey", "Pkey"},
+		},
+		{
+			relName: "users",
+			pgNames: []string{"positive_balance"},
+			goNames: []string{"PositiveBalance"},
+		},
+		{
+			relName: "users",
+			pgNames: []string{"email_key", "users_email_key"},
+			goNames: []string{"EmailKey", "UsersEmailKey"},
+		},
+		{
+			relName: "users",
+			pgNames: []string{"users_email_key", "email_key"},
+			goNames: []string{"EmailKey", "EmailKey2"},
+		},
+	}
+
+	for i, c := range cases {
+		constraints := make([]ConstraintMeta, 0, len(c.pgNames))
+		for _, pgName := range c.pgNames {
+			constraints = append(constraints, ConstraintMeta{PgName: pgName})
+		}
+
+		assignConstraintGoNames(c.relName, constraints)
+
+		goNames := make([]string, 0, len(constraints))
+		for _, constraint := range constraints {
+			goNames = append(goNames, constraint.GoName)
+		}
+		if !reflect.DeepEqual(goNames, c.goNames) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.goNames, goNames)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package meta
+
+// file: through.go
+// This file contains the logic for resolving many-to-many relationships
+// between tables which are mediated by a join table. Such relationships can
+// be configured explicitly with `has_many_through` or infered from join tables
+// which contain nothing but foreign keys to the two tables they connect.
+
+import (
+	"fmt"
+
+	"github.com/opendoor/pggen/gen/internal/config"
+	"github.com/opendoor/pggen/gen/internal/names"
+)
+
+// ThroughRefMeta contains information about a many-to-many relationship
+// between two tables by way of a join table.
+type ThroughRefMeta struct {
+	// The metadata for the table which gets the generated field
+	PointsFrom *TableMeta
+	// The metadata for the table at the far end of the join table
+	PointsTo *TableMeta
+	// The quoted postgres name of the join table
+	PgJoinTable string
+	// The name of the column in the join table which points to `PointsFrom`
+	PgFromKeyField string
+	// The name of the column in the join table which points to `PointsTo`
+	PgToKeyField string
+	// The name of the field that should be generated in the `PointsFrom` model
+	GoFieldName string
+	// A snake_case version of GoFieldName. Used as the include spec key.
+	PgFieldName string
+	// True if this relationship was infered rather than explicitly configured
+	Infered bool
+}
+
+// joinTableCol is a column in a join table along with the table and column
+// that it points to (if the column has a foreign key on it).
+type joinTableCol struct {
+	name string
+	// The quoted name of the table this column points to. Blank if
+	// there is no foreign key on this column.
+	pointsTo    string
+	pointsToCol string
+}
+
+// buildThroughReferencesMapping fills in the `AllThroughReferences` for every
+// table. MUST be called after both the incoming and outgoing references for all
+// tables have been filled in so that name collisions can be detected.
+func (tr *tableResolver) buildThroughReferencesMapping(
+	tables []config.TableConfig,
+	infoTab map[string]*TableMeta,
+) error {
+	for i := range tables {
+		table := &tables[i]
+		quotedName := mustConfigPgNameToQuoted(table.Name)
+		meta := infoTab[quotedName]
+
+		explicitJoinTables := map[string]bool{}
+		for _, hmt := range table.HasManyThrough {
+			ref, err := tr.configuredThroughRef(meta, &hmt, infoTab)
+			if err != nil {
+				return fmt.Errorf("%s: has_many_through: %s", table.Name, err.Error())
+			}
+			explicitJoinTables[ref.PgJoinTable] = true
+			meta.AllThroughReferences = append(meta.AllThroughReferences, ref)
+		}
+
+		if table.NoInferHasManyThrough {
+			continue
+		}
+
+		infered, err := tr.inferThroughRefs(meta, infoTab)
+		if err != nil {
+			return fmt.Errorf("%s: infering has_many_through: %s", table.Name, err.Error())
+		}
+		for _, ref := range infered {
+			// prevent inference when we have an explicit config
+			if !explicitJoinTables[ref.PgJoinTable] {
+				meta.AllThroughReferences = append(meta.AllThroughReferences, ref)
+			}
+		}
+	}
+
+	for _, meta := range infoTab {
+		err := disambiguateThroughReflist(meta)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range meta.AllThroughReferences {
+			ref.PointsTo.ThroughReferenceTarget = true
+		}
+	}
+
+	return nil
+}
+
+// configuredThroughRef resolves a `has_many_through` config block attached to
+// the table described by `meta`.
+func (tr *tableResolver) configuredThroughRef(
+	meta *TableMeta,
+	hmt *config.HasManyThrough,
+	infoTab map[string]*TableMeta,
+) (ThroughRefMeta, error) {
+	if len(hmt.Table) == 0 {
+		return ThroughRefMeta{}, fmt.Errorf("requires 'table' key")
+	}
+	if len(hmt.Through) == 0 {
+		return ThroughRefMeta{}, fmt.Errorf("requires 'through' key")
+	}
+
+	targetQuotedName := mustConfigPgNameToQuoted(hmt.Table)
+	target, ok := infoTab[targetQuotedName]
+	if !ok {
+		return ThroughRefMeta{}, fmt.Errorf("table '%s' is not configured", hmt.Table)
+	}
+
+	joinName, err := names.ParsePgName(hmt.Through)
+	if err != nil {
+		return ThroughRefMeta{}, err
+	}
+	joinCols, err := tr.joinTableCols(joinName)
+	if err != nil {
+		return ThroughRefMeta{}, err
+	}
+	if len(joinCols) == 0 {
+		return ThroughRefMeta{}, fmt.Errorf("could not find join table '%s' in the database", hmt.Through)
+	}
+
+	fromKey, err := pickJoinKey(joinCols, hmt.KeyField, "key_field", meta, "")
+	if err != nil {
+		return ThroughRefMeta{}, err
+	}
+	toKey, err := pickJoinKey(joinCols, hmt.TargetKeyField, "target_key_field", target, fromKey)
+	if err != nil {
+		return ThroughRefMeta{}, err
+	}
+
+	ref := ThroughRefMeta{
+		PointsFrom:     meta,
+		PointsTo:       target,
+		PgJoinTable:    joinName.String(),
+		PgFromKeyField: fromKey,
+		PgToKeyField:   toKey,
+		GoFieldName:    target.Info.PluralGoName,
+		PgFieldName:    target.Info.PgName,
+	}
+	if hmt.FieldName != "" {
+		ref.GoFieldName = names.PgToGoName(hmt.FieldName)
+		ref.PgFieldName = hmt.FieldName
+	}
+
+	return ref, nil
+}
+
+// pickJoinKey figures out which column of a join table should be used to point
+// to the given table. If the user has not explicitly configured a column, there
+// must be exactly one column with a foreign key pointing to the primary key
+// of `pointsTo` (ignoring the `exclude` column).
+func pickJoinKey(
+	joinCols []joinTableCol,
+	configured string,
+	configKey string,
+	pointsTo *TableMeta,
+	exclude string,
+) (string, error) {
+	if configured != "" {
+		for _, col := range joinCols {
+			if col.name == configured {
+				return configured, nil
+			}
+		}
+		return "", fmt.Errorf("join table has no column '%s'", configured)
+	}
+
+	var candidates []string
+	for _, col := range joinCols {
+		if col.name == exclude || col.pointsTo != pointsTo.Info.PgName {
+			continue
+		}
+		if pointsTo.Info.PkeyCol == nil || col.pointsToCol != pointsTo.Info.PkeyCol.PgName {
+			continue
+		}
+		candidates = append(candidates, col.name)
+	}
+	if len(candidates) != 1 {
+		return "", fmt.Errorf(
+			"could not determine which column of the join table points to '%s' (%d candidates), please set '%s'",
+			pointsTo.Info.PgName,
+			len(candidates),
+			configKey,
+		)
+	}
+
+	return candidates[0], nil
+}
+
+// joinTableCols returns all the columns of the given join table along with the
+// tables that they point to.
+func (tr *tableResolver) joinTableCols(joinTable names.PgName) ([]joinTableCol, error) {
+	rows, err := tr.db.Query(`
+		SELECT
+			a.attname AS col_name,
+			COALESCE(tns.nspname, '') AS points_to_schema,
+			COALESCE(t.relname, '') AS points_to,
+			COALESCE(ta.attname, '') AS points_to_col
+		FROM pg_attribute a
+		JOIN pg_class j
+			ON (j.oid = a.attrelid)
+		JOIN pg_namespace jns
+			ON (j.relnamespace = jns.oid)
+		LEFT JOIN pg_constraint c
+			ON (c.conrelid = j.oid AND c.contype = 'f' AND c.conkey = ARRAY[a.attnum])
+		LEFT JOIN pg_class t
+			ON (t.oid = c.confrelid)
+		LEFT JOIN pg_namespace tns
+			ON (t.relnamespace = tns.oid)
+		LEFT JOIN pg_attribute ta
+			ON (ta.attrelid = c.confrelid AND ta.attnum = c.confkey[1])
+		WHERE jns.nspname = $1
+		  AND j.relname = $2
+		  AND a.attnum > 0
+		  AND NOT a.attisdropped
+		ORDER BY a.attnum
+		`, joinTable.Schema, joinTable.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []joinTableCol
+	for rows.Next() {
+		var (
+			col            joinTableCol
+			pointsToSchema string
+			pointsToTable  string
+		)
+		err = rows.Scan(&col.name, &pointsToSchema, &pointsToTable, &col.pointsToCol)
+		if err != nil {
+			return nil, err
+		}
+		if pointsToTable != "" {
+			col.pointsTo = (&names.PgName{Schema: pointsToSchema, Name: pointsToTable}).String()
+		}
+		cols = append(cols, col)
+	}
+
+	return cols, rows.Err()
+}
+
+// inferThroughRefs finds all the join tables which connect the table described by
+// `meta` to some other configured table. A table is considered to be a join table
+// if it has exactly two single-column foreign keys which point to the primary keys
+// of two different tables, and every other column is either part of its primary key
+// or has a default value.
+func (tr *tableResolver) inferThroughRefs(
+	meta *TableMeta,
+	infoTab map[string]*TableMeta,
+) ([]ThroughRefMeta, error) {
+	if meta.Info.PkeyCol == nil {
+		return nil, nil
+	}
+
+	tableName, err := names.ParsePgName(meta.Info.PgName)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tr.db.Query(`
+		SELECT
+			jns.nspname AS join_schema,
+			j.relname AS join_table,
+			fa.attname AS from_key,
+			fra.attname AS from_ref_col,
+			tns.nspname AS target_schema,
+			t.relname AS target_table,
+			ta.attname AS to_key,
+			tra.attname AS to_ref_col
+		FROM pg_constraint fc
+		JOIN pg_class o
+			ON (o.oid = fc.confrelid)
+		JOIN pg_namespace ons
+			ON (o.relnamespace = ons.oid)
+		JOIN pg_class j
+			ON (j.oid = fc.conrelid)
+		JOIN pg_namespace jns
+			ON (j.relnamespace = jns.oid)
+		JOIN pg_attribute fa
+			ON (fa.attrelid = j.oid AND fa.attnum = fc.conkey[1])
+		JOIN pg_attribute fra
+			ON (fra.attrelid = o.oid AND fra.attnum = fc.confkey[1])
+		JOIN pg_constraint tc
+			ON (tc.conrelid = j.oid AND tc.contype = 'f' AND tc.oid <> fc.oid)
+		JOIN pg_class t
+			ON (t.oid = tc.confrelid)
+		JOIN pg_namespace tns
+			ON (t.relnamespace = tns.oid)
+		JOIN pg_attribute ta
+			ON (ta.attrelid = j.oid AND ta.attnum = tc.conkey[1])
+		JOIN pg_attribute tra
+			ON (tra.attrelid = t.oid AND tra.attnum = tc.confkey[1])
+		WHERE fc.contype = 'f'
+		  AND ons.nspname = $1
+		  AND o.relname = $2
+		  AND array_length(fc.conkey, 1) = 1
+		  AND array_length(tc.conkey, 1) = 1
+		  AND tc.confrelid <> fc.confrelid
+		  AND j.oid <> fc.confrelid
+		  AND j.oid <> tc.confrelid
+		  AND (SELECT count(*) FROM pg_constraint c WHERE c.conrelid = j.oid AND c.contype = 'f') = 2
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM pg_attribute a
+			LEFT JOIN pg_attrdef ad
+				ON (ad.adrelid = a.attrelid AND ad.adnum = a.attnum)
+			LEFT JOIN pg_constraint pk
+				ON (pk.conrelid = a.attrelid AND pk.contype = 'p' AND a.attnum = ANY(pk.conkey))
+			WHERE a.attrelid = j.oid
+			  AND a.attnum > 0
+			  AND NOT a.attisdropped
+			  AND a.attnum <> fc.conkey[1]
+			  AND a.attnum <> tc.conkey[1]
+			  AND ad.adnum IS NULL
+			  AND pk.oid IS NULL
+		  )
+		ORDER BY j.relname
+		`, tableName.Schema, tableName.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []ThroughRefMeta
+	for rows.Next() {
+		var (
+			joinSchema   string
+			joinTable    string
+			fromKey      string
+			fromRefCol   string
+			targetSchema string
+			targetTable  string
+			toKey        string
+			toRefCol     string
+		)
+		err = rows.Scan(
+			&joinSchema, &joinTable, &fromKey, &fromRefCol,
+			&targetSchema, &targetTable, &toKey, &toRefCol,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		target, inTOMLConfig := infoTab[(&names.PgName{Schema: targetSchema, Name: targetTable}).String()]
+		if !inTOMLConfig || target.Info.PkeyCol == nil {
+			continue
+		}
+		if fromRefCol != meta.Info.PkeyCol.PgName || toRefCol != target.Info.PkeyCol.PgName {
+			// we only know how to follow references to primary keys
+			continue
+		}
+
+		refs = append(refs, ThroughRefMeta{
+			PointsFrom:     meta,
+			PointsTo:       target,
+			PgJoinTable:    (&names.PgName{Schema: joinSchema, Name: joinTable}).String(),
+			PgFromKeyField: fromKey,
+			PgToKeyField:   toKey,
+			GoFieldName:    target.Info.PluralGoName,
+			PgFieldName:    target.Info.PgName,
+			Infered:        true,
+		})
+	}
+
+	return refs, rows.Err()
+}
+
+// disambiguateThroughReflist ensures that the fields generated for the through
+// references of the given table don't collide with each other or with the fields
+// generated for direct references. Infered references get the name of the join
+// table appended to them, while colliding explicitly configured references are
+// an error.
+func disambiguateThroughReflist(meta *TableMeta) error {
+	taken := map[string]bool{}
+	for _, ref := range meta.AllIncomingReferences {
+		taken[ref.PgPointsFromFieldName] = true
+	}
+	for _, ref := range meta.AllOutgoingReferences {
+		taken[ref.PgPointsToFieldName] = true
+	}
+
+	for i, ref := range meta.AllThroughReferences {
+		if taken[ref.PgFieldName] {
+			if !ref.Infered {
+				return fmt.Errorf(
+					"%s: has_many_through field '%s' collides with another generated field, please set 'field_name'",
+					meta.Info.PgName,
+					ref.PgFieldName,
+				)
+			}
+
+			joinName, err := names.ParsePgName(ref.PgJoinTable)
+			if err != nil {
+				return err
+			}
+			meta.AllThroughReferences[i].PgFieldName += "_via_" + joinName.Name
+			meta.AllThroughReferences[i].GoFieldName += "Via" + names.PgToGoName(joinName.Name)
+		}
+
+		taken[meta.AllThroughReferences[i].PgFieldName] = true
+	}
+
+	return nil
+}
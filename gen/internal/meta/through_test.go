@@ -0,0 +1,128 @@
+package meta
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPickJoinKey(t *testing.T) {
+	users := &TableMeta{Info: PgTableInfo{PgName: "users"}}
+	users.Info.Cols = []ColMeta{{PgName: "id", IsPrimary: true}}
+	users.Info.PkeyCol = &users.Info.Cols[0]
+
+	type testCase struct {
+		// inputs
+		joinCols   []joinTableCol
+		configured string
+		exclude    string
+		// outputs
+		key string
+		err string
+	}
+
+	cases := []testCase{
+		{
+			joinCols: []joinTableCol{
+				{name: "id"},
+				{name: "user_id", pointsTo: "users", pointsToCol: "id"},
+				{name: "group_id", pointsTo: "groups", pointsToCol: "id"},
+			},
+			key: "user_id",
+		},
+		{
+			joinCols: []joinTableCol{
+				{name: "user_id", pointsTo: "users", pointsToCol: "email"},
+			},
+			err: "0 candidates.*please set 'key_field'",
+		},
+		{
+			joinCols: []joinTableCol{
+				{name: "follower_id", pointsTo: "users", pointsToCol: "id"},
+				{name: "followee_id", pointsTo: "users", pointsToCol: "id"},
+			},
+			err: "2 candidates",
+		},
+		{
+			joinCols: []joinTableCol{
+				{name: "follower_id", pointsTo: "users", pointsToCol: "id"},
+				{name: "followee_id", pointsTo: "users", pointsToCol: "id"},
+			},
+			exclude: "follower_id",
+			key:     "followee_id",
+		},
+		{
+			joinCols: []joinTableCol{
+				{name: "follower_id", pointsTo: "users", pointsToCol: "id"},
+				{name: "user_ref"},
+			},
+			configured: "user_ref",
+			key:        "user_ref",
+		},
+		{
+			joinCols: []joinTableCol{
+				{name: "follower_id", pointsTo: "users", pointsToCol: "id"},
+			},
+			configured: "nope",
+			err:        "join table has no column 'nope'",
+		},
+	}
+
+	for i, c := range cases {
+		key, err := pickJoinKey(c.joinCols, c.configured, "key_field", users, c.exclude)
+
+		if c.err == "" && err != nil {
+			t.Fatalf("%d: got err when expecting none: %s", i, err.Error())
+		}
+
+		if c.err != "" {
+			if err == nil {
+				t.Fatalf("%d: got no err when expecting one to match /%s/", i, c.err)
+			}
+			matched, regexErr := regexp.Match(c.err, []byte(err.Error()))
+			if regexErr != nil {
+				t.Fatalf("%d: bad pattern /%s/", i, c.err)
+			}
+			if !matched {
+				t.Fatalf("%d: expected err '%s' to match pattern /%s/", i, err.Error(), c.err)
+			}
+			continue
+		}
+
+		if key != c.key {
+			t.Fatalf("%d: expected key '%s', got '%s'", i, c.key, key)
+		}
+	}
+}
+
+func TestDisambiguateThroughReflist(t *testing.T) {
+	meta := &TableMeta{
+		Info: PgTableInfo{PgName: "users"},
+		AllIncomingReferences: []RefMeta{
+			{PgPointsFromFieldName: "groups", GoPointsFromFieldName: "Groups"},
+		},
+		AllThroughReferences: []ThroughRefMeta{
+			{PgJoinTable: "user_groups", PgFieldName: "groups", GoFieldName: "Groups", Infered: true},
+			{PgJoinTable: "admins", PgFieldName: "admin_of", GoFieldName: "AdminOf"},
+		},
+	}
+
+	err := disambiguateThroughReflist(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.AllThroughReferences[0].PgFieldName != "groups_via_user_groups" ||
+		meta.AllThroughReferences[0].GoFieldName != "GroupsViaUserGroups" {
+		t.Fatalf("unexpected infered names: %+v", meta.AllThroughReferences[0])
+	}
+	if meta.AllThroughReferences[1].PgFieldName != "admin_of" {
+		t.Fatalf("unexpected configured name: %+v", meta.AllThroughReferences[1])
+	}
+
+	meta.AllThroughReferences = append(meta.AllThroughReferences, ThroughRefMeta{
+		PgJoinTable: "memberships", PgFieldName: "admin_of", GoFieldName: "AdminOf",
+	})
+	err = disambiguateThroughReflist(meta)
+	if err == nil {
+		t.Fatal("expected a collision error")
+	}
+}
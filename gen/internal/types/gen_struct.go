@@ -66,8 +66,11 @@ type {{ .GoName }} struct {
 	{{- /* All outgoing references are 1-1, so we don't check the .OneToOne flag */}}
 	{{ .GoPointsToFieldName }} *{{ .PointsTo.Info.GoName }}
 	{{- end}}
+	{{- range .Meta.AllThroughReferences }}
+	{{ .GoFieldName }} []*{{ .PointsTo.Info.GoName }}
+	{{- end }}
 }
-func (r *{{ .GoName }}) Scan(ctx context.Context, client *PGClient, rs *sql.Rows) error {
+func (r *{{ .GoName }}) Scan(ctx context.Context, client *PGClient, rs PGRows) error {
 	client.rwlockFor{{ .GoName }}.RLock()
 	if client.colIdxTabFor{{ .GoName }} == nil {
 		client.rwlockFor{{ .GoName }}.RUnlock() // release the lock to allow the write lock to be aquired
@@ -161,6 +164,44 @@ var scannerTabFor{{ .GoName }} = [...]func(*{{ .GoName }}, *nullableScanTgtsFor{
 	{{- end }}
 }
 
+{{- if .Meta.ThroughReferenceTarget }}
+
+// scanWithThroughKey scans a row which contains all the columns of a {{ .GoName }}
+// along with an extra 'pggen_through_key' column holding the key of the record
+// on the other side of a join table. The column index table is not consulted
+// because the extra column would throw off the mapping used by plain Scan calls.
+func (r *{{ .GoName }}) scanWithThroughKey(rs PGRows, cols []string, key interface{}) error {
+	var nullableTgts nullableScanTgtsFor{{ .GoName }}
+
+	scanTgts := make([]interface{}, len(cols))
+	for runIdx, colName := range cols {
+		genIdx, inTable := genTimeColIdxTabFor{{ .GoName }}[colName]
+		if colName == "pggen_through_key" {
+			scanTgts[runIdx] = key
+		} else if inTable {
+			scanTgts[runIdx] = scannerTabFor{{ .GoName }}[genIdx](r, &nullableTgts)
+		} else {
+			scanTgts[runIdx] = &pggenSinkScanner{}
+		}
+	}
+
+	err := rs.Scan(scanTgts...)
+	if err != nil {
+		return err
+	}
+
+	{{- range .Meta.Info.Cols }}
+	{{- if .Nullable }}
+	r.{{ .GoName }} = {{ call .TypeInfo.NullConvertFunc (printf "nullableTgts.scan%s" .GoName) }}
+	{{- else if (eq .TypeInfo.Name "time.Time") }}
+	r.{{ .GoName }} = {{ printf "nullableTgts.scan%s" .GoName }}.Time
+	{{- end }}
+	{{- end }}
+
+	return nil
+}
+{{- end }}
+
 var genTimeColIdxTabFor{{ .GoName }} map[string]int = map[string]int{
 	{{- range $i, $col := .Meta.Info.Cols }}
 	` + "`" + `{{ $col.PgName }}` + "`" + `: {{ $i }},
@@ -0,0 +1,105 @@
+package include
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph describes the relationships between tables which include specs may
+// traverse. It maps the name of each table to a mapping from the names that
+// the table uses to refer to related tables to the names of those tables.
+// For example, if the `users` table had a 1-* relationship with the `posts`
+// table, the graph would contain
+//
+// ```go
+// include.Graph{
+//     "users": {"posts": "posts"},
+//     "posts": {"users": "users"},
+// }
+// ```
+//
+// pggen emits a Graph describing all of the tables that it generates code for,
+// which the generated code uses to validate include specs.
+type Graph map[string]map[string]string
+
+// Validate checks that the given spec is a spec for the `root` table and that every
+// edge in it refers to a relationship that exists in the graph. A nil error
+// indicates that the spec is valid.
+func (g Graph) Validate(root string, spec *Spec) error {
+	if spec.TableName != root {
+		return fmt.Errorf(
+			"include spec: expected a spec for '%s', got '%s'", root, spec.TableName)
+	}
+
+	return g.validate(spec, map[*Spec]bool{})
+}
+
+func (g Graph) validate(spec *Spec, seen map[*Spec]bool) error {
+	if seen[spec] {
+		// we have already checked this part of a cyclic spec
+		return nil
+	}
+	seen[spec] = true
+
+	if len(spec.Includes) == 0 {
+		return nil
+	}
+
+	edges, inGraph := g[spec.TableName]
+	if !inGraph {
+		return fmt.Errorf("include spec: unknown table '%s'", spec.TableName)
+	}
+
+	// sort the edges so that we always complain about the same one first
+	names := make([]string, 0, len(spec.Includes))
+	for name := range spec.Includes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		subSpec := spec.Includes[name]
+
+		target, isEdge := edges[name]
+		if !isEdge {
+			return fmt.Errorf(
+				"include spec: table '%s' has no reference named '%s' (known references: %s)",
+				spec.TableName,
+				name,
+				knownReferences(edges),
+			)
+		}
+		if subSpec.TableName != target {
+			return fmt.Errorf(
+				"include spec: '%s.%s' refers to the '%s' table, not '%s' (try '%s->%s')",
+				spec.TableName,
+				name,
+				target,
+				subSpec.TableName,
+				name,
+				target,
+			)
+		}
+
+		err := g.validate(subSpec, seen)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func knownReferences(edges map[string]string) string {
+	if len(edges) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(edges))
+	for name := range edges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,111 @@
+package include
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGraphValidate(t *testing.T) {
+	graph := Graph{
+		"users":  {"posts": "posts", "groups": "groups"},
+		"posts":  {"users": "users", "author": "users"},
+		"groups": {"members": "users"},
+	}
+
+	type testCase struct {
+		root string
+		src  string
+		// a regex that the error must match, or empty if the spec is valid
+		re string
+	}
+
+	cases := []testCase{
+		{
+			root: "users",
+			src:  "users",
+		},
+		{
+			root: "users",
+			src:  "users.{posts.users, groups.members->users}",
+		},
+		{
+			root: "users",
+			src:  "users.posts.author->users.posts[limit=1]",
+		},
+		{
+			root: "posts",
+			src:  "users.posts",
+			re:   "expected a spec for 'posts', got 'users'",
+		},
+		{
+			root: "users",
+			src:  "users.postz",
+			re:   `table 'users' has no reference named 'postz' \(known references: groups, posts\)`,
+		},
+		{
+			root: "users",
+			src:  "users.posts.{users, comments}",
+			re:   "table 'posts' has no reference named 'comments'",
+		},
+		{
+			root: "users",
+			src:  "users.groups.members",
+			re:   `'groups.members' refers to the 'users' table, not 'members' \(try 'members->users'\)`,
+		},
+		{
+			root: "posts",
+			src:  "posts.author->groups",
+			re:   "refers to the 'users' table, not 'groups'",
+		},
+		{
+			root: "comments",
+			src:  "comments.posts",
+			re:   "unknown table 'comments'",
+		},
+	}
+
+	for i, c := range cases {
+		err := graph.Validate(c.root, Must(Parse(c.src)))
+		if c.re == "" {
+			if err != nil {
+				t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("case %d: expected an error matching /%s/", i, c.re)
+		}
+		matches, regexErr := regexp.Match(c.re, []byte(err.Error()))
+		if regexErr != nil {
+			t.Fatalf("case %d: bad regex /%s/", i, c.re)
+		}
+		if !matches {
+			t.Fatalf("case %d: /%s/ failed to match '%s'", i, c.re, err.Error())
+		}
+	}
+}
+
+func TestGraphValidateCyclic(t *testing.T) {
+	graph := Graph{
+		"foo": {"bar": "bar"},
+		"bar": {"foo": "foo"},
+	}
+
+	cyclic := Spec{
+		TableName: "foo",
+	}
+	cyclic.Includes = map[string]*Spec{
+		"bar": {
+			TableName: "bar",
+			Includes: map[string]*Spec{
+				"foo": &cyclic,
+			},
+		},
+	}
+
+	err := graph.Validate("foo", &cyclic)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
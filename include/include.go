@@ -40,18 +40,41 @@
 // `sales` table referred to the users table with the name `customer`, an include
 // spec for pulling customer data would look like `sales.customer->users`.
 //
+// By default, filling in an include spec loads every child record attached to
+// a parent record. Each child in an include spec can have a list of modifiers
+// attached to it in square brackets to restrict which child records get loaded.
+// The `order` modifier orders the children by the given column (`asc` or `desc`
+// may follow the column name), the `limit` modifier caps the number of children
+// loaded for each parent record, and the `where` modifier filters the children
+// with a named predicate declared in the pggen config file for the child table.
+// `order` and `where` may be repeated. For example, to load the 20 most recent
+// published comments on a post you could write:
+//
+// ```go
+// spec := include.Must(include.Parse("posts.comments[order=created_at desc, limit=20, where=published]"))
+// ```
+//
 // More formally, the grammar for include specs is:
 //
 // spec ::= id
 //        | id '.' inner_spec
 //        | id '.' '{' spec_list '}'
-// inner_spec ::= id
-//        | rename_or_id '.' inner_spec
-//        | rename_or_id '.' '{' spec_list '}'
+// inner_spec ::= edge
+//        | edge '.' inner_spec
+//        | edge '.' '{' spec_list '}'
+// edge ::= rename_or_id
+//        | rename_or_id '[' modifier_list ']'
 // rename_or_id ::= id '->' id
 //                | id
 // spec_list ::= inner_spec
 //             | inner_spec ',' inner_spec
+// modifier_list ::= modifier
+//                 | modifier ',' modifier_list
+// modifier ::= 'order' '=' id
+//            | 'order' '=' id 'asc'
+//            | 'order' '=' id 'desc'
+//            | 'limit' '=' [0-9]+
+//            | 'where' '=' id
 //
 // Cyclic Include Specs:
 //
@@ -85,6 +108,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -96,6 +120,30 @@ type Spec struct {
 	TableName string
 	// All the child tables to fill in
 	Includes map[string]*Spec
+	// Restrictions on which records of this table get loaded. Only meaningful
+	// for child specs. nil if there are no restrictions.
+	Modifiers *Modifiers
+}
+
+// Modifiers restrict the set of child records which are loaded for a given
+// child in an include spec.
+type Modifiers struct {
+	// The columns to order child records by, in order of precedence
+	OrderBy []OrderTerm
+	// The maximum number of child records to load for each parent record.
+	// Zero indicates that there is no limit.
+	Limit int
+	// The names of predicates declared in the pggen config file for the child
+	// table which child records must satisfy.
+	Where []string
+}
+
+// OrderTerm is a single column in an `order` modifier
+type OrderTerm struct {
+	// The name of the column to order by
+	Column string
+	// If true, order in descending rather than ascending order
+	Desc bool
 }
 
 func (s *Spec) String() string {
@@ -183,6 +231,14 @@ func parseSpec(src string, idx int, inner bool) (spec specReference, nextIdx int
 		if err != nil {
 			return
 		}
+
+		idx = skipWS(src, idx)
+		if idx < len(src) && src[idx] == '[' {
+			spec.subSpec.Modifiers, idx, err = parseModifierList(src, idx)
+			if err != nil {
+				return
+			}
+		}
 	} else {
 		spec.subSpec.TableName, idx, err = parseID(src, idx)
 		if err != nil {
@@ -319,6 +375,188 @@ func parseSpecList(src string, idx int) (specs []specReference, nextIdx int, err
 	return
 }
 
+// parse '[' modifier (',' modifier)* ','? ']'
+func parseModifierList(src string, idx int) (mods *Modifiers, nextIdx int, err error) {
+	mods = &Modifiers{}
+
+	unexpectedEOI := func(i int) error {
+		return &parseError{
+			pos: i,
+			msg: "unexpected end of input while parsing modifier list",
+		}
+	}
+
+	idx++
+	idx = skipWS(src, idx)
+	if idx >= len(src) {
+		err = unexpectedEOI(idx)
+		return
+	}
+
+	// not needed, but produces a nicer error message
+	if src[idx] == ']' {
+		err = &parseError{
+			pos: idx,
+			msg: "empty modifier list",
+		}
+		return
+	}
+
+	for {
+		idx, err = parseModifier(src, idx, mods)
+		if err != nil {
+			return
+		}
+
+		idx = skipWS(src, idx)
+		if idx >= len(src) {
+			err = unexpectedEOI(idx)
+			return
+		}
+
+		if src[idx] == ']' {
+			idx++
+			break
+		}
+
+		if src[idx] != ',' {
+			err = &parseError{
+				pos: idx,
+				msg: "expected ',' to separate modifiers",
+			}
+			return
+		}
+		idx++
+		idx = skipWS(src, idx)
+		if idx >= len(src) {
+			err = unexpectedEOI(idx)
+			return
+		}
+
+		// allow trailing comma
+		if src[idx] == ']' {
+			idx++
+			break
+		}
+	}
+
+	nextIdx = idx
+	return
+}
+
+// parse a single modifier into `mods`
+func parseModifier(src string, idx int, mods *Modifiers) (nextIdx int, err error) {
+	unexpectedEOI := func(i int) error {
+		return &parseError{
+			pos: i,
+			msg: "unexpected end of input while parsing a modifier",
+		}
+	}
+
+	keyStart := idx
+	key, idx, err := parseID(src, idx)
+	if err != nil {
+		return
+	}
+
+	idx = skipWS(src, idx)
+	if idx >= len(src) {
+		err = unexpectedEOI(idx)
+		return
+	}
+	if src[idx] != '=' {
+		err = &parseError{
+			pos: idx,
+			msg: fmt.Sprintf("expected '=' after modifier '%s'", key),
+		}
+		return
+	}
+	idx = skipWS(src, idx+1)
+	if idx >= len(src) {
+		err = unexpectedEOI(idx)
+		return
+	}
+
+	switch key {
+	case "order":
+		var term OrderTerm
+		term.Column, idx, err = parseID(src, idx)
+		if err != nil {
+			return
+		}
+
+		// look for an optional direction
+		dirIdx := skipWS(src, idx)
+		if dirIdx < len(src) && src[dirIdx] != ',' && src[dirIdx] != ']' {
+			var dir string
+			dir, dirIdx, err = parseID(src, dirIdx)
+			if err != nil {
+				return
+			}
+			switch strings.ToLower(dir) {
+			case "asc":
+			case "desc":
+				term.Desc = true
+			default:
+				err = &parseError{
+					pos: idx,
+					msg: fmt.Sprintf("expected 'asc' or 'desc', got '%s'", dir),
+				}
+				return
+			}
+			idx = dirIdx
+		}
+
+		mods.OrderBy = append(mods.OrderBy, term)
+	case "limit":
+		if mods.Limit != 0 {
+			err = &parseError{
+				pos: keyStart,
+				msg: "duplicate 'limit' modifier",
+			}
+			return
+		}
+
+		digitsStart := idx
+		for idx < len(src) && '0' <= src[idx] && src[idx] <= '9' {
+			idx++
+		}
+		if idx == digitsStart {
+			err = &parseError{
+				pos: idx,
+				msg: "expected a number after 'limit='",
+			}
+			return
+		}
+		var limit int
+		limit, err = strconv.Atoi(src[digitsStart:idx])
+		if err != nil || limit <= 0 {
+			err = &parseError{
+				pos: digitsStart,
+				msg: fmt.Sprintf("limit must be a positive number, got '%s'", src[digitsStart:idx]),
+			}
+			return
+		}
+		mods.Limit = limit
+	case "where":
+		var pred string
+		pred, idx, err = parseID(src, idx)
+		if err != nil {
+			return
+		}
+		mods.Where = append(mods.Where, pred)
+	default:
+		err = &parseError{
+			pos: keyStart,
+			msg: fmt.Sprintf("unknown modifier '%s' (expected 'order', 'limit' or 'where')", key),
+		}
+		return
+	}
+
+	nextIdx = idx
+	return
+}
+
 // parse id '->' id | id
 //
 // If this just parses a solitary id, then the returned `id` with be the
@@ -464,6 +702,10 @@ func (s *Spec) writeToBuilder(b *strings.Builder, seen map[*Spec]bool, stop bool
 	}
 	seen[s] = true
 
+	if s.Modifiers != nil {
+		s.Modifiers.writeToBuilder(b)
+	}
+
 	if len(s.Includes) == 1 {
 		b.WriteByte('.')
 		for n, subSpec := range s.Includes {
@@ -500,6 +742,32 @@ func (s *Spec) writeToBuilder(b *strings.Builder, seen map[*Spec]bool, stop bool
 	}
 }
 
+func (m *Modifiers) writeToBuilder(b *strings.Builder) {
+	mods := make([]string, 0, len(m.OrderBy)+len(m.Where)+1)
+	for _, term := range m.OrderBy {
+		var mod strings.Builder
+		mod.WriteString("order=")
+		writeIdent(&mod, term.Column)
+		if term.Desc {
+			mod.WriteString(" desc")
+		}
+		mods = append(mods, mod.String())
+	}
+	if m.Limit > 0 {
+		mods = append(mods, "limit="+strconv.Itoa(m.Limit))
+	}
+	for _, pred := range m.Where {
+		var mod strings.Builder
+		mod.WriteString("where=")
+		writeIdent(&mod, pred)
+		mods = append(mods, mod.String())
+	}
+
+	b.WriteByte('[')
+	b.WriteString(strings.Join(mods, ","))
+	b.WriteByte(']')
+}
+
 func writeIdent(b *strings.Builder, ident string) {
 	if unquotedIdentRE.Match([]byte(ident)) {
 		b.WriteString(ident)
@@ -108,6 +108,24 @@ func TestParseSuccess(t *testing.T) {
 		{
 			src: `"a.b".c`,
 		},
+		// modifiers
+		{
+			src: "posts.comments[order=created_at desc,limit=20,where=published]",
+		},
+		{
+			src:    "posts.comments [ limit = 20 , order = created_at DESC, where=published, ]",
+			result: "posts.comments[order=created_at desc,limit=20,where=published]",
+		},
+		{
+			src:    "posts.comments[order=score desc, order=id asc, where=a, where=b].author",
+			result: "posts.comments[order=score desc,order=id,where=a,where=b].author",
+		},
+		{
+			src: "posts.{comments[limit=1],tags}",
+		},
+		{
+			src: `posts.top->comments[order="Weird Col"]`,
+		},
 	}
 
 	for i, c := range cases {
@@ -184,6 +202,46 @@ func TestParseErrors(t *testing.T) {
 			src: `top_level->rename.bad`,
 			re:  "unexpected extra token begining with '-'",
 		},
+		{
+			src: "posts[limit=1]",
+			re:  "unexpected extra token begining with '\\['",
+		},
+		{
+			src: "posts.comments[]",
+			re:  "empty modifier list",
+		},
+		{
+			src: "posts.comments[limit=1",
+			re:  "unexpected end of input while parsing modifier list",
+		},
+		{
+			src: "posts.comments[limit=0]",
+			re:  "limit must be a positive number",
+		},
+		{
+			src: "posts.comments[limit=1, limit=2]",
+			re:  "duplicate 'limit' modifier",
+		},
+		{
+			src: "posts.comments[limit=x]",
+			re:  "expected a number after 'limit='",
+		},
+		{
+			src: "posts.comments[order=x sideways]",
+			re:  "expected 'asc' or 'desc', got 'sideways'",
+		},
+		{
+			src: "posts.comments[offset=1]",
+			re:  "unknown modifier 'offset'",
+		},
+		{
+			src: "posts.comments[limit 1]",
+			re:  "expected '=' after modifier 'limit'",
+		},
+		{
+			src: "posts.comments[limit=1 where=a]",
+			re:  "expected ',' to separate modifiers",
+		},
 	}
 
 	for i, c := range cases {
@@ -0,0 +1,15 @@
+// includecheck validates include specs passed to pggen generated code.
+//
+// Run it directly with `includecheck ./...` or as part of `go vet` with
+// `go vet -vettool=$(which includecheck) ./...`.
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/opendoor/pggen/includecheck"
+)
+
+func main() {
+	singlechecker.Main(includecheck.Analyzer)
+}
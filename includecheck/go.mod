@@ -0,0 +1,16 @@
+module github.com/opendoor/pggen/includecheck
+
+go 1.22.0
+
+require (
+	github.com/opendoor/pggen v0.0.0
+	golang.org/x/tools v0.30.0
+)
+
+require (
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+)
+
+// The analyzer is developed alongside the include package
+replace github.com/opendoor/pggen => ../
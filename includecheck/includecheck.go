@@ -0,0 +1,316 @@
+// package includecheck defines an analyzer which validates include specs
+// written as string literals against the schema that pggen generated code for.
+//
+// pggen emits a static graph of the references between tables (`includeGraph`)
+// into every package that it generates table code for. The analyzer records that
+// graph as a fact about the generated package, then checks every call to a
+// generated `<Entity>FillIncludes`, `<Entity>BulkFillIncludes` or
+// `Validate<Entity>Includes` routine whose include spec is written as
+// `include.Must(include.Parse("..."))` with a constant string. Specs which fail
+// to parse or which refer to relationships that don't exist are reported.
+//
+// The analyzer can be run on its own with the `includecheck` command in `cmd/includecheck`, or
+// as part of `go vet` with `go vet -vettool=$(which includecheck) ./...`.
+package includecheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"regexp"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+
+	"github.com/opendoor/pggen/include"
+)
+
+const includePkgPath = "github.com/opendoor/pggen/include"
+
+var Analyzer = &analysis.Analyzer{
+	Name:      "includecheck",
+	Doc:       "check that include specs passed to pggen generated code refer to real relationships",
+	Requires:  []*analysis.Analyzer{inspect.Analyzer},
+	Run:       run,
+	FactTypes: []analysis.Fact{new(graphFact)},
+}
+
+// graphFact is the include graph emitted into a package by pggen
+type graphFact struct {
+	Graph include.Graph
+	// A mapping from the go names of entities to the names of their tables
+	Roots map[string]string
+}
+
+func (*graphFact) AFact() {}
+
+func (f *graphFact) String() string {
+	return fmt.Sprintf("includeGraph(%d tables)", len(f.Graph))
+}
+
+var (
+	fillIncludesRE     = regexp.MustCompile(`^(\w+?)(Bulk)?FillIncludes$`)
+	validateIncludesRE = regexp.MustCompile(`^Validate(\w+)Includes$`)
+)
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	localFact := findGraph(pass)
+	if localFact != nil {
+		pass.ExportPackageFact(localFact)
+	}
+
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	insp.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+
+		callee := calleeFunc(pass, call)
+		if callee == nil || callee.Pkg() == nil {
+			return
+		}
+
+		var goName string
+		if m := fillIncludesRE.FindStringSubmatch(callee.Name()); m != nil {
+			goName = m[1]
+		} else if m := validateIncludesRE.FindStringSubmatch(callee.Name()); m != nil {
+			goName = m[1]
+		} else {
+			return
+		}
+
+		var fact *graphFact
+		if callee.Pkg() == pass.Pkg {
+			fact = localFact
+		} else {
+			var imported graphFact
+			if pass.ImportPackageFact(callee.Pkg(), &imported) {
+				fact = &imported
+			}
+		}
+		if fact == nil {
+			return
+		}
+		root, ok := fact.Roots[goName]
+		if !ok {
+			return
+		}
+
+		specArg := specArgument(callee, call)
+		if specArg == nil {
+			return
+		}
+		lit := literalSpec(pass, specArg)
+		if lit == nil {
+			return
+		}
+
+		spec, err := include.Parse(constant.StringVal(pass.TypesInfo.Types[lit].Value))
+		if err != nil {
+			pass.Reportf(lit.Pos(), "invalid include spec: %s", err.Error())
+			return
+		}
+		err = fact.Graph.Validate(root, spec)
+		if err != nil {
+			pass.Reportf(lit.Pos(), "%s", err.Error())
+		}
+	})
+
+	return nil, nil
+}
+
+// findGraph looks for the include graph emitted by pggen in the package being
+// analyzed, returning nil if there is none.
+func findGraph(pass *analysis.Pass) *graphFact {
+	var fact *graphFact
+
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, s := range decl.Specs {
+					valueSpec, ok := s.(*ast.ValueSpec)
+					if !ok || len(valueSpec.Names) != 1 || len(valueSpec.Values) != 1 ||
+						valueSpec.Names[0].Name != "includeGraph" {
+						continue
+					}
+					graph, ok := graphFromLit(pass, valueSpec.Values[0])
+					if !ok {
+						continue
+					}
+					if fact == nil {
+						fact = &graphFact{Roots: map[string]string{}}
+					}
+					fact.Graph = graph
+				}
+			case *ast.FuncDecl:
+				m := validateIncludesRE.FindStringSubmatch(decl.Name.Name)
+				if m == nil || decl.Recv != nil {
+					continue
+				}
+				root, ok := validateRoot(pass, decl)
+				if !ok {
+					continue
+				}
+				if fact == nil {
+					fact = &graphFact{Roots: map[string]string{}}
+				}
+				fact.Roots[m[1]] = root
+			}
+		}
+	}
+
+	if fact == nil || fact.Graph == nil {
+		return nil
+	}
+	return fact
+}
+
+// graphFromLit converts an `include.Graph{...}` composite literal into a graph
+func graphFromLit(pass *analysis.Pass, expr ast.Expr) (include.Graph, bool) {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || !isIncludeType(pass.TypesInfo.TypeOf(lit), "Graph") {
+		return nil, false
+	}
+
+	graph := include.Graph{}
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, false
+		}
+		table, ok := stringConst(pass, kv.Key)
+		if !ok {
+			return nil, false
+		}
+		edgesLit, ok := kv.Value.(*ast.CompositeLit)
+		if !ok {
+			return nil, false
+		}
+
+		edges := map[string]string{}
+		for _, edgeElt := range edgesLit.Elts {
+			edgeKV, ok := edgeElt.(*ast.KeyValueExpr)
+			if !ok {
+				return nil, false
+			}
+			name, ok := stringConst(pass, edgeKV.Key)
+			if !ok {
+				return nil, false
+			}
+			target, ok := stringConst(pass, edgeKV.Value)
+			if !ok {
+				return nil, false
+			}
+			edges[name] = target
+		}
+		graph[table] = edges
+	}
+
+	return graph, true
+}
+
+// validateRoot extracts the table name from the body of a generated
+// `Validate<Entity>Includes` routine.
+func validateRoot(pass *analysis.Pass, decl *ast.FuncDecl) (string, bool) {
+	if decl.Body == nil || len(decl.Body.List) != 1 {
+		return "", false
+	}
+	ret, ok := decl.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", false
+	}
+	call, ok := ret.Results[0].(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Validate" {
+		return "", false
+	}
+	recv, ok := sel.X.(*ast.Ident)
+	if !ok || recv.Name != "includeGraph" {
+		return "", false
+	}
+	return stringConst(pass, call.Args[0])
+}
+
+// specArgument returns the argument passed for the first *include.Spec parameter
+func specArgument(callee *types.Func, call *ast.CallExpr) ast.Expr {
+	sig, ok := callee.Type().(*types.Signature)
+	if !ok {
+		return nil
+	}
+	params := sig.Params()
+	for i := 0; i < params.Len() && i < len(call.Args); i++ {
+		ptr, ok := params.At(i).Type().(*types.Pointer)
+		if ok && isIncludeType(ptr.Elem(), "Spec") {
+			return call.Args[i]
+		}
+	}
+	return nil
+}
+
+// literalSpec returns the constant string expression in an
+// `include.Must(include.Parse(<const>))` or `include.Parse(<const>)` expression.
+func literalSpec(pass *analysis.Pass, expr ast.Expr) ast.Expr {
+	call, ok := unparen(expr).(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return nil
+	}
+	callee := calleeFunc(pass, call)
+	if callee == nil || callee.Pkg() == nil || callee.Pkg().Path() != includePkgPath {
+		return nil
+	}
+
+	switch callee.Name() {
+	case "Must":
+		return literalSpec(pass, call.Args[0])
+	case "Parse":
+		if _, ok := stringConst(pass, call.Args[0]); ok {
+			return call.Args[0]
+		}
+	}
+	return nil
+}
+
+func calleeFunc(pass *analysis.Pass, call *ast.CallExpr) *types.Func {
+	var id *ast.Ident
+	switch fun := unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+	f, _ := pass.TypesInfo.Uses[id].(*types.Func)
+	return f
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+func isIncludeType(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == includePkgPath && obj.Name() == name
+}
+
+func stringConst(pass *analysis.Pass, expr ast.Expr) (string, bool) {
+	tv, ok := pass.TypesInfo.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
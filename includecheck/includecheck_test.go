@@ -0,0 +1,13 @@
+package includecheck_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+
+	"github.com/opendoor/pggen/includecheck"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), includecheck.Analyzer, "models", "app")
+}
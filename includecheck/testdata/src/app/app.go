@@ -0,0 +1,24 @@
+package app
+
+import (
+	"context"
+
+	"github.com/opendoor/pggen/include"
+
+	"models"
+)
+
+const postsSpec = "users.posts"
+
+func use(ctx context.Context, p *models.PGClient, u *models.User, post *models.Post, dynamic string) {
+	_ = p.UserFillIncludes(ctx, u, include.Must(include.Parse("users.posts.users")))
+	_ = p.UserFillIncludes(ctx, u, include.Must(include.Parse(postsSpec)))
+	_ = p.PostFillIncludes(ctx, post, include.Must(include.Parse("posts.editor->users")))
+	_ = p.UserBulkFillIncludes(ctx, []*models.User{u}, include.Must(include.Parse("users.post"))) // want `table 'users' has no reference named 'post' \(known references: posts\)`
+	_ = p.PostFillIncludes(ctx, post, include.Must(include.Parse("posts.editor"))) // want `'posts.editor' refers to the 'users' table, not 'editor'`
+	_ = p.PostFillIncludes(ctx, post, include.Must(include.Parse("users.posts"))) // want `expected a spec for 'posts', got 'users'`
+	_ = models.ValidateUserIncludes(include.Must(include.Parse("users.{posts"))) // want `invalid include spec`
+
+	// specs that are not constant can't be checked
+	_ = p.UserFillIncludes(ctx, u, include.Must(include.Parse(dynamic)))
+}
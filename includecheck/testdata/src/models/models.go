@@ -0,0 +1,49 @@
+package models // want package:`includeGraph\(2 tables\)`
+
+// models mimics the code that pggen generates for a schema
+
+import (
+	"context"
+
+	"github.com/opendoor/pggen/include"
+)
+
+type PGClient struct{}
+
+type User struct{}
+
+type Post struct{}
+
+func (p *PGClient) UserFillIncludes(ctx context.Context, rec *User, includes *include.Spec) error {
+	return nil
+}
+
+func (p *PGClient) UserBulkFillIncludes(ctx context.Context, recs []*User, includes *include.Spec) error {
+	return nil
+}
+
+func (p *PGClient) PostFillIncludes(ctx context.Context, rec *Post, includes *include.Spec) error {
+	return nil
+}
+
+func ValidateUserIncludes(includes *include.Spec) error {
+	return includeGraph.Validate(`users`, includes)
+}
+
+func ValidatePostIncludes(includes *include.Spec) error {
+	return includeGraph.Validate(`posts`, includes)
+}
+
+var includeGraph include.Graph = include.Graph{
+	`users`: {
+		`posts`: `posts`,
+	},
+	`posts`: {
+		`users`:  `users`,
+		`editor`: `users`,
+	},
+}
+
+func localUse(p *PGClient, u *User) {
+	_ = p.UserFillIncludes(nil, u, include.Must(include.Parse("users.postz"))) // want `table 'users' has no reference named 'postz'`
+}
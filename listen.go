@@ -0,0 +1,201 @@
+package pggen
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// file: listen.go
+// This file contains the machinery behind the generated `Listen` methods, which
+// hold a dedicated connection open to receive postgres notifications.
+
+// The bounds on how long Listen waits between attempts to re-establish a
+// failed connection.
+const (
+	listenMinBackoff = 100 * time.Millisecond
+	listenMaxBackoff = 30 * time.Second
+)
+
+// ListenConnector runs `fn` with a connection dedicated to listening for
+// notifications. The connection may only be used until `fn` returns, after which
+// the connector releases it.
+type ListenConnector func(ctx context.Context, fn func(conn *pgx.Conn) error) error
+
+// SQLListenConnector returns a ListenConnector which takes connections out of
+// the given database/sql connection pool. Listening relies on pgx, so the pool
+// must be using the pgx database/sql driver (github.com/jackc/pgx/v4/stdlib).
+func SQLListenConnector(db DBConn) ListenConnector {
+	return func(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+		sqlConn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = sqlConn.Close()
+		}()
+
+		// the pgx connection belongs to database/sql outside of Raw, so all of
+		// the listening has to happen inside of it.
+		return sqlConn.Raw(func(driverConn interface{}) error {
+			pgxConn, ok := driverConn.(interface{ Conn() *pgx.Conn })
+			if !ok {
+				return fmt.Errorf(
+					"pggen: listening requires the pgx database/sql driver, got a %T", driverConn)
+			}
+			conn := pgxConn.Conn()
+			defer unlisten(conn)
+			return fn(conn)
+		})
+	}
+}
+
+// PgxListenConnector returns a ListenConnector for the given pgx connection.
+// Connections are acquired from a `*pgxpool.Pool`, while for a single connection
+// such as a `*pgx.Conn` a new connection with the same configuration is opened
+// for each attempt at listening.
+func PgxListenConnector(handle PgxConn) ListenConnector {
+	return func(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+		// pgxpool lives in its own module, so we look for its Acquire method rather
+		// than depending on it directly.
+		acquire := reflect.ValueOf(handle).MethodByName("Acquire")
+		if acquire.IsValid() {
+			res := acquire.Call([]reflect.Value{reflect.ValueOf(ctx)})
+			if err, ok := res[1].Interface().(error); ok && err != nil {
+				return err
+			}
+			poolConn, ok := res[0].Interface().(interface {
+				Conn() *pgx.Conn
+				Release()
+			})
+			if !ok {
+				return fmt.Errorf("pggen: cannot listen on a connection acquired from a %T", handle)
+			}
+			defer poolConn.Release()
+			conn := poolConn.Conn()
+			defer unlisten(conn)
+			return fn(conn)
+		}
+
+		var config *pgx.ConnConfig
+		switch h := handle.(type) {
+		case *pgx.Conn:
+			config = h.Config()
+		case interface{ Conn() *pgx.Conn }:
+			config = h.Conn().Config()
+		default:
+			return fmt.Errorf("pggen: cannot open a connection to listen on from a %T", handle)
+		}
+		conn, err := pgx.ConnectConfig(ctx, config)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = conn.Close(context.Background())
+		}()
+		return fn(conn)
+	}
+}
+
+// unlisten clears the channels that a connection is listening on before it is
+// handed back to a pool. A broken connection will fail to do so, which is fine
+// since the pool will throw it away anyway.
+func unlisten(conn *pgx.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = conn.Exec(ctx, "UNLISTEN *")
+}
+
+// Listen listens for notifications on the given channel using a connection opened
+// with `connect`, returning a channel of their payloads. Listen only returns an error
+// if it fails to start listening. After that, if the connection fails it is released
+// and Listen keeps trying to open a new one until it succeeds, backing off between
+// attempts. Notifications sent while there is no connection are lost. The payload
+// channel is closed once `ctx` is done.
+//
+// Generated code calls Listen for each configured channel, so there is usually no
+// need to call it directly.
+func Listen(
+	ctx context.Context,
+	connect ListenConnector,
+	channel string,
+	opts ...ListenOpt,
+) (<-chan string, error) {
+	var listenOpts ListenOptions
+	for _, opt := range opts {
+		opt(&listenOpts)
+	}
+
+	payloads := make(chan string)
+	// carries the result of the first attempt at listening
+	started := make(chan error, 1)
+	go func() {
+		defer close(payloads)
+
+		first := true
+		backoff := listenMinBackoff
+		for {
+			listening := false
+			err := connect(ctx, func(conn *pgx.Conn) error {
+				_, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+				if err != nil {
+					return err
+				}
+				listening = true
+				if first {
+					first = false
+					started <- nil
+				}
+				return forwardNotifications(ctx, conn, payloads)
+			})
+			if first {
+				started <- err
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			listenOpts.ReportError(err)
+
+			if listening {
+				backoff = listenMinBackoff
+			} else {
+				backoff *= 2
+				if backoff > listenMaxBackoff {
+					backoff = listenMaxBackoff
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+	}()
+
+	err := <-started
+	if err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
+
+// forwardNotifications sends the payloads of the notifications that arrive on
+// `conn` to `payloads` until the connection fails or `ctx` is done.
+func forwardNotifications(ctx context.Context, conn *pgx.Conn, payloads chan<- string) error {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case payloads <- notification.Payload:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
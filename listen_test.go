@@ -0,0 +1,20 @@
+package pggen
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestListenFailsToStart(t *testing.T) {
+	connect := func(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+		return fmt.Errorf("no database")
+	}
+
+	_, err := Listen(context.Background(), connect, "events")
+	if err == nil || err.Error() != "no database" {
+		t.Fatalf("expected the connection error, got: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"context"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context which records the given actor as the one responsible
+// for the writes made with it. Writes to tables configured with `audit = true` store
+// the actor in the history that they generate, which makes this a good thing to call
+// from request middleware once the caller has been authenticated.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor recorded in the given context by WithActor.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
@@ -11,7 +11,9 @@
 // In addition to allowing you to hook SQL operations, you can attach an ErrorConverter
 // routine to the DBConnWrapper. This routine will be called by the generated code before
 // any error is returned. This allows you to conveniantly translate pggen errors into the
-// error format used in the rest of your application.
+// error format used in the rest of your application. Violations of constraints on the
+// tables pggen knows about reach the ErrorConverter as a *pggen.ConstraintViolationError,
+// which can be picked out with pggen.AsConstraintViolation.
 package middleware
 
 import (
@@ -1,7 +1,24 @@
 package pggen
 
+import (
+	"database/sql"
+	"time"
+
+	"github.com/opendoor/pggen/include"
+)
+
 // options.go contains functional options that can be passed to generated code.
 
+// The row locking clauses which get and list methods may be asked to add to their queries.
+const (
+	LockForUpdate      = "FOR UPDATE"
+	LockForNoKeyUpdate = "FOR NO KEY UPDATE"
+	LockForShare       = "FOR SHARE"
+
+	LockNoWait     = "NOWAIT"
+	LockSkipLocked = "SKIP LOCKED"
+)
+
 type InsertOpt func(opts *InsertOptions)
 type InsertOptions struct {
 	UsePkey           bool
@@ -64,11 +81,69 @@ func UpsertDefaultFields(fieldSet FieldSet) UpsertOpt {
 
 type GetOpt func(opts *GetOptions)
 type GetOptions struct {
+	Includes       *include.Spec
+	IncludeOpts    []IncludeOpt
+	IncludeDeleted bool
+	LockStrength   string
+	LockWait       string
+}
+
+// GetWithIncludes tells a get method to fill in the given include spec for
+// the record that it loads, as if the corresponding FillIncludes method had
+// been called on the result.
+func GetWithIncludes(includes *include.Spec, includeOpts ...IncludeOpt) GetOpt {
+	return func(opts *GetOptions) {
+		opts.Includes = includes
+		opts.IncludeOpts = includeOpts
+	}
+}
+
+// GetIncludeDeleted tells a get method to return the record even if it has
+// been soft deleted. If soft deletes have not been configured for the table
+// (via the `deleted_at_field` config key), this flag has no effect.
+func GetIncludeDeleted(opts *GetOptions) {
+	opts.IncludeDeleted = true
+}
+
+// GetForUpdate tells a get method to lock the record it loads with
+// `SELECT ... FOR UPDATE`. Row locks may only be taken within a transaction.
+func GetForUpdate(opts *GetOptions) {
+	opts.LockStrength = LockForUpdate
+}
+
+// GetForNoKeyUpdate tells a get method to lock the record it loads with
+// `SELECT ... FOR NO KEY UPDATE`. Row locks may only be taken within a transaction.
+func GetForNoKeyUpdate(opts *GetOptions) {
+	opts.LockStrength = LockForNoKeyUpdate
+}
+
+// GetForShare tells a get method to lock the record it loads with
+// `SELECT ... FOR SHARE`. Row locks may only be taken within a transaction.
+func GetForShare(opts *GetOptions) {
+	opts.LockStrength = LockForShare
+}
+
+// GetNoWait tells a get method which has been asked to lock its record to
+// fail immediately rather than wait if the record is already locked.
+func GetNoWait(opts *GetOptions) {
+	opts.LockWait = LockNoWait
+}
+
+// GetSkipLocked tells a get method which has been asked to lock its record
+// to treat the record as missing if it is already locked.
+func GetSkipLocked(opts *GetOptions) {
+	opts.LockWait = LockSkipLocked
 }
 
 type ListOpt func(opts *ListOptions)
 type ListOptions struct {
 	SucceedOnPartialResults bool
+	Includes                *include.Spec
+	IncludeOpts             []IncludeOpt
+	IncludeDeleted          bool
+	LockStrength            string
+	LockWait                string
+	Missing                 interface{}
 }
 
 // ListSucceedOnPartialResults tells a list method to not
@@ -77,9 +152,71 @@ func ListSucceedOnPartialResults(opts *ListOptions) {
 	opts.SucceedOnPartialResults = true
 }
 
+// ListWithIncludes tells a list method to fill in the given include spec for
+// the records that it loads, as if the corresponding BulkFillIncludes method
+// had been called on the results.
+func ListWithIncludes(includes *include.Spec, includeOpts ...IncludeOpt) ListOpt {
+	return func(opts *ListOptions) {
+		opts.Includes = includes
+		opts.IncludeOpts = includeOpts
+	}
+}
+
+// ListIncludeDeleted tells a list method to return records even if they have
+// been soft deleted. It only applies to the records being listed, pass
+// `IncludeDeleted` along with any includes to load soft deleted children as well.
+// If soft deletes have not been configured for the table (via the `deleted_at_field`
+// config key), this flag has no effect.
+func ListIncludeDeleted(opts *ListOptions) {
+	opts.IncludeDeleted = true
+}
+
+// ListMissing tells a list method to report the ids which it could not find
+// by storing them in `missing`, which must be a pointer to a slice of the primary
+// key type of the table being listed (e.g. a `*[]int64`). This is most useful in
+// combination with `ListSucceedOnPartialResults`.
+func ListMissing(missing interface{}) ListOpt {
+	return func(opts *ListOptions) {
+		opts.Missing = missing
+	}
+}
+
+// ListForUpdate tells a list method to lock the records it loads with
+// `SELECT ... FOR UPDATE`. Row locks may only be taken within a transaction.
+func ListForUpdate(opts *ListOptions) {
+	opts.LockStrength = LockForUpdate
+}
+
+// ListForNoKeyUpdate tells a list method to lock the records it loads with
+// `SELECT ... FOR NO KEY UPDATE`. Row locks may only be taken within a transaction.
+func ListForNoKeyUpdate(opts *ListOptions) {
+	opts.LockStrength = LockForNoKeyUpdate
+}
+
+// ListForShare tells a list method to lock the records it loads with
+// `SELECT ... FOR SHARE`. Row locks may only be taken within a transaction.
+func ListForShare(opts *ListOptions) {
+	opts.LockStrength = LockForShare
+}
+
+// ListNoWait tells a list method which has been asked to lock its records to
+// fail immediately rather than wait if any of the records are already locked.
+func ListNoWait(opts *ListOptions) {
+	opts.LockWait = LockNoWait
+}
+
+// ListSkipLocked tells a list method which has been asked to lock its records
+// to leave out any records which are already locked. Since this means that
+// fewer records than were asked for may come back, it is usually combined
+// with `ListSucceedOnPartialResults`.
+func ListSkipLocked(opts *ListOptions) {
+	opts.LockWait = LockSkipLocked
+}
+
 type DeleteOpt func(opts *DeleteOptions)
 type DeleteOptions struct {
 	DoHardDelete bool
+	Cascade      *include.Spec
 }
 
 // DeleteDoHardDelete tells a delete method to delete the data from the database
@@ -90,6 +227,18 @@ func DeleteDoHardDelete(opts *DeleteOptions) {
 	opts.DoHardDelete = true
 }
 
+// DeleteCascade tells a delete method to also delete the child records mentioned
+// in the given include spec, recursively, within the same transaction. Each child
+// table is deleted from just as if its own delete method had been called, so children
+// are soft deleted if their table has a `deleted_at` timestamp configured and
+// hard deleted otherwise (or if `DeleteDoHardDelete` is also passed). The spec may
+// only contain references from child records.
+func DeleteCascade(spec *include.Spec) DeleteOpt {
+	return func(opts *DeleteOptions) {
+		opts.Cascade = spec
+	}
+}
+
 type UpdateOpt func(opts *UpdateOptions)
 type UpdateOptions struct {
 	DisableTimestamps bool
@@ -103,4 +252,67 @@ func UpdateDisableTimestamps(opts *UpdateOptions) {
 
 type IncludeOpt func(opts *IncludeOptions)
 type IncludeOptions struct {
+	MaxConcurrency int
+	IncludeDeleted bool
+}
+
+// IncludeConcurrently tells a fill includes method to fetch sibling branches
+// of the include spec in parallel, issuing at most `maxConcurrency` queries
+// at once. Parallel fetching only happens when the client is backed by a
+// connection pool (a *sql.DB). Transactions and single connections can only
+// run one query at a time, so they always fetch branches one after another.
+func IncludeConcurrently(maxConcurrency int) IncludeOpt {
+	return func(opts *IncludeOptions) {
+		opts.MaxConcurrency = maxConcurrency
+	}
+}
+
+// IncludeDeleted tells a fill includes method to load related records even
+// if they have been soft deleted. By default, soft deleted records are left out.
+func IncludeDeleted(opts *IncludeOptions) {
+	opts.IncludeDeleted = true
+}
+
+// Retry settings used by the generated WithTx method when it is not given any options,
+// or when the corresponding TxOptions fields are left as zero.
+const (
+	DefaultTxMaxRetries = 3
+	DefaultTxBackoff    = 10 * time.Millisecond
+)
+
+// TxOptions configures the transactions run by the generated WithTx method.
+// A nil *TxOptions means a default isolation level with DefaultTxMaxRetries
+// retries and a backoff of DefaultTxBackoff, as does the zero value.
+type TxOptions struct {
+	// The options used to begin each attempt at the transaction
+	sql.TxOptions
+	// The number of times to retry a transaction which fails with a serialization
+	// failure or a deadlock. Zero means DefaultTxMaxRetries, and a negative value
+	// means that transactions are never retried.
+	MaxRetries int
+	// How long to wait before the first retry. The wait roughly doubles with
+	// each retry after that. Zero means DefaultTxBackoff, and a negative value
+	// means that retries happen right away.
+	Backoff time.Duration
+}
+
+type ListenOpt func(opts *ListenOptions)
+type ListenOptions struct {
+	OnError func(err error)
+}
+
+// ListenOnError tells a listen method to call `fn` with the errors that it
+// recovers from, such as a dropped connection or a payload which fails to decode.
+// By default, such errors are ignored.
+func ListenOnError(fn func(err error)) ListenOpt {
+	return func(opts *ListenOptions) {
+		opts.OnError = fn
+	}
+}
+
+// ReportError passes the given error to the OnError callback, if there is one
+func (opts *ListenOptions) ReportError(err error) {
+	if opts.OnError != nil {
+		opts.OnError(err)
+	}
 }
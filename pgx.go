@@ -0,0 +1,86 @@
+package pggen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// file: pgx.go
+// This file defines the interfaces that code generated with `backend = "pgx"`
+// uses to talk to the database, along with some adapters that allow such code
+// to keep the same method signatures as code generated for database/sql.
+
+// PgxHandle is the set of pgx methods that the generated code uses to run queries.
+// It is implemented by `*pgxpool.Pool`, `*pgxpool.Conn`, `*pgx.Conn` and `pgx.Tx`.
+type PgxHandle interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// PgxConn is a PgxHandle which can start transactions. It is what the generated
+// `NewPGClient` accepts when generating code for pgx, and it is implemented by
+// `*pgxpool.Pool`, `*pgxpool.Conn` and `*pgx.Conn`.
+type PgxConn interface {
+	PgxHandle
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// PgxRows adapts a pgx.Rows to the subset of the `*sql.Rows` API that the generated
+// code relies on, so that the generated `Scan` methods work the same way for both
+// backends.
+type PgxRows struct {
+	pgx.Rows
+}
+
+// Close closes the rows, returning any error encountered while reading them
+// just like `(*sql.Rows).Close` does.
+func (r *PgxRows) Close() error {
+	r.Rows.Close()
+	return r.Rows.Err()
+}
+
+// Columns returns the names of the columns in the result set
+func (r *PgxRows) Columns() ([]string, error) {
+	fields := r.Rows.FieldDescriptions()
+	cols := make([]string, len(fields))
+	for i, field := range fields {
+		cols[i] = string(field.Name)
+	}
+	return cols, nil
+}
+
+// PgxTxOptions converts the database/sql transaction options accepted by the
+// generated `BeginTx` methods into their pgx equivalent. A nil 'opts' means
+// the default options.
+func PgxTxOptions(opts *sql.TxOptions) (pgx.TxOptions, error) {
+	var pgxOpts pgx.TxOptions
+	if opts == nil {
+		return pgxOpts, nil
+	}
+
+	switch opts.Isolation {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		pgxOpts.IsoLevel = pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		pgxOpts.IsoLevel = pgx.ReadCommitted
+	case sql.LevelRepeatableRead:
+		pgxOpts.IsoLevel = pgx.RepeatableRead
+	case sql.LevelSerializable:
+		pgxOpts.IsoLevel = pgx.Serializable
+	default:
+		return pgxOpts, fmt.Errorf("pggen: unsupported isolation level: %s", opts.Isolation)
+	}
+
+	if opts.ReadOnly {
+		pgxOpts.AccessMode = pgx.ReadOnly
+	}
+
+	return pgxOpts, nil
+}
@@ -0,0 +1,57 @@
+package pggen
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	_ PgxConn   = &pgx.Conn{}
+	_ PgxHandle = pgx.Tx(nil)
+)
+
+func TestPgxTxOptions(t *testing.T) {
+	type testCase struct {
+		opts     *sql.TxOptions
+		expected pgx.TxOptions
+		isErr    bool
+	}
+
+	cases := []testCase{
+		{
+			opts:     nil,
+			expected: pgx.TxOptions{},
+		},
+		{
+			opts:     &sql.TxOptions{},
+			expected: pgx.TxOptions{},
+		},
+		{
+			opts: &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true},
+			expected: pgx.TxOptions{
+				IsoLevel:   pgx.Serializable,
+				AccessMode: pgx.ReadOnly,
+			},
+		},
+		{
+			opts:     &sql.TxOptions{Isolation: sql.LevelRepeatableRead},
+			expected: pgx.TxOptions{IsoLevel: pgx.RepeatableRead},
+		},
+		{
+			opts:  &sql.TxOptions{Isolation: sql.LevelLinearizable},
+			isErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		actual, err := PgxTxOptions(c.opts)
+		if (err != nil) != c.isErr {
+			t.Fatalf("case %d: unexpected error state: %v", i, err)
+		}
+		if !c.isErr && actual != c.expected {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package pggen
+
+import (
+	"context"
+)
+
+// file: replicas.go
+// This file defines the context key used to pin reads to the primary database
+// when a generated client has read replicas.
+
+type usePrimaryKey struct{}
+
+// UsePrimary returns a context which causes the read methods of a client created
+// with NewPGClientWithReplicas to read from the primary rather than a replica. This
+// allows callers to read their own writes without worrying about replication lag.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usePrimaryKey{}, true)
+}
+
+// UsesPrimary reports whether the given context was derived from one returned by
+// UsePrimary.
+func UsesPrimary(ctx context.Context) bool {
+	usePrimary, _ := ctx.Value(usePrimaryKey{}).(bool)
+	return usePrimary
+}
@@ -43,4 +43,8 @@ else
     # schema dynamically. We could fix this by creating a dedicated database for the example tests.
     go test -race -p 1 ./...
     DB_DRIVER=postgres go test -race -p 1 ./cmd/pggen/test # re-run using lib/pq as the driver
+
+    # the include spec analyzer lives in its own module so that the main module
+    # does not have to depend on x/tools
+    (cd includecheck && go test ./...)
 fi